@@ -0,0 +1,109 @@
+package hcheck
+
+// Aggregate computes the overall status from the results of the tests, which
+// don't include the informational ones, replacing the worst status of all
+// tests. It can be set to the Aggregate method of a CompositeAggregator. When
+// nil, the worst status decides.
+var Aggregate func(tests map[string]Test) Status
+
+// Policy combines several statuses into one, such as the statuses of the tests
+// of a component.
+type Policy func(statuses []Status) Status
+
+// WorstOf is a Policy which returns the worst of the statuses, in the order set
+// through SetStatusOrder, or Available when there are none.
+func WorstOf(statuses []Status) Status {
+	return getOverallStatus(statuses)
+}
+
+// Quorum returns a Policy which returns Available when at least n of the
+// statuses are Available, such as a component with redundant replicas which
+// keeps working while a quorum is left. Below the quorum, it returns Degraded
+// while any of them is Available, and the worst of them otherwise.
+func Quorum(n int) Policy {
+	return func(statuses []Status) Status {
+		available := 0
+		for _, s := range statuses {
+			if s == Available {
+				available++
+			}
+		}
+
+		switch {
+		case available >= n:
+			return Available
+		case available > 0:
+			return Degraded
+		default:
+			return WorstOf(statuses)
+		}
+	}
+}
+
+// CompositeAggregator computes the overall status in two levels: the tests of
+// each component roll up into the status of the component, then the statuses
+// of the components combine into the overall status. Tests without a component
+// form a component of their own, with an empty name.
+type CompositeAggregator struct {
+	// Components represents the policies which roll up the tests of the
+	// components, keyed by component.
+	Components map[string]Policy
+
+	// Default represents the policy of the components without one in
+	// Components. When nil, WorstOf is used.
+	Default Policy
+
+	// Critical represents the components which can make the service worse
+	// than Degraded. The status of any other component counts as Degraded at
+	// worst. When empty, every component is critical.
+	Critical []string
+
+	// Combine represents the policy which combines the statuses of the
+	// components. When nil, WorstOf is used.
+	Combine Policy
+}
+
+// Aggregate computes the overall status from the results of the tests.
+func (a CompositeAggregator) Aggregate(tests map[string]Test) Status {
+	components := map[string][]Status{}
+	for _, t := range tests {
+		components[t.Component] = append(components[t.Component], t.Status)
+	}
+
+	statuses := make([]Status, 0, len(components))
+	for component, s := range components {
+		policy, ok := a.Components[component]
+		if !ok {
+			policy = a.Default
+		}
+		if policy == nil {
+			policy = WorstOf
+		}
+
+		status := policy(s)
+		if !a.isCritical(component) && rank(status) > rank(Degraded) {
+			status = Degraded
+		}
+		statuses = append(statuses, status)
+	}
+
+	if a.Combine == nil {
+		return WorstOf(statuses)
+	}
+
+	return a.Combine(statuses)
+}
+
+func (a CompositeAggregator) isCritical(component string) bool {
+	if len(a.Critical) == 0 {
+		return true
+	}
+
+	for _, c := range a.Critical {
+		if c == component {
+			return true
+		}
+	}
+
+	return false
+}
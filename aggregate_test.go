@@ -0,0 +1,94 @@
+package hcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCompositeAggregator(t *testing.T) {
+	tests := map[string]Test{
+		"db-1":    {Component: "db", Status: Available},
+		"db-2":    {Component: "db", Status: Unavailable},
+		"db-3":    {Component: "db", Status: Available},
+		"cache-1": {Component: "cache", Status: Unavailable},
+		"config":  {Status: Available},
+	}
+
+	tcs := []struct {
+		name     string
+		agg      CompositeAggregator
+		expected Status
+	}{
+		{"worst of all", CompositeAggregator{}, Unavailable},
+		{"quorum per component", CompositeAggregator{
+			Components: map[string]Policy{"db": Quorum(2), "cache": Quorum(1)},
+		}, Unavailable},
+		{"quorum and critical", CompositeAggregator{
+			Components: map[string]Policy{"db": Quorum(2)},
+			Critical:   []string{"db"},
+		}, Degraded},
+		{"quorum not met", CompositeAggregator{
+			Components: map[string]Policy{"db": Quorum(3)},
+			Critical:   []string{"db"},
+		}, Degraded},
+		{"default quorum", CompositeAggregator{
+			Default:  Quorum(1),
+			Critical: []string{"cache"},
+		}, Unavailable},
+		{"quorum of components", CompositeAggregator{
+			Components: map[string]Policy{"db": Quorum(2)},
+			Combine:    Quorum(2),
+		}, Available},
+	}
+
+	for _, tc := range tcs {
+		if s := tc.agg.Aggregate(tests); s != tc.expected {
+			t.Fatalf("Expected '%s' to equal '%s', got '%s'", tc.name, tc.expected, s)
+		}
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	tcs := []struct {
+		statuses []Status
+		expected Status
+	}{
+		{[]Status{Available, Available, Unavailable}, Available},
+		{[]Status{Available, Unavailable, Unavailable}, Degraded},
+		{[]Status{Degraded, Unavailable, Unavailable}, Unavailable},
+		{nil, Available},
+	}
+
+	for _, tc := range tcs {
+		if s := Quorum(2)(tc.statuses); s != tc.expected {
+			t.Fatalf("Expected quorum of '%v' to equal '%s', got '%s'", tc.statuses, tc.expected, s)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("replica-1", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("replica-1")
+	}, WithComponent("db"))
+	RegisterTest("replica-2", func(_ context.Context) (Status, error) {
+		return Available, nil
+	}, WithComponent("db"))
+	RegisterTest("replica-3", func(_ context.Context) (Status, error) {
+		return Available, nil
+	}, WithComponent("db"))
+
+	Aggregate = CompositeAggregator{
+		Components: map[string]Policy{"db": Quorum(2)},
+	}.Aggregate
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Status != Available {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Available, hc.Status)
+	}
+}
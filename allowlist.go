@@ -0,0 +1,106 @@
+package hcheck
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPAllowlistMiddleware returns middleware which responds with 403 Forbidden,
+// without running any tests, to requests from sources outside the given
+// CIDRs, such as the internal network or the subnet of the load balancer. A
+// plain IP address allows just that address. It returns an error when any of
+// the CIDRs or trusted proxies is malformed.
+//
+// The source is the remote address of the connection. The X-Forwarded-For
+// header can be set by anyone, so it's only taken into account when the remote
+// address is one of the trusted proxies: the header is then read from right to
+// left, skipping the addresses of trusted proxies, and the first other address
+// is the source. Without trusted proxies, the header is ignored.
+func IPAllowlistMiddleware(cidrs []string, trustedProxies ...string) (MiddlewareFunc, error) {
+	allowed, err := parseCIDRs(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := parseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := sourceIP(r, trusted)
+			if ip == nil || !containsIP(allowed, ip) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, Error(fmt.Sprintf("invalid IP address %q", cidr))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, Error(fmt.Sprintf("invalid CIDR %q", cidr))
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourceIP returns the address the request originates from, following the
+// X-Forwarded-For header through the trusted proxies.
+func sourceIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trusted, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			return nil
+		}
+		if !containsIP(trusted, hop) {
+			return hop
+		}
+		ip = hop
+	}
+
+	// every hop is a trusted proxy, such as a probe of the proxy itself
+	return ip
+}
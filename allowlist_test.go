@@ -0,0 +1,59 @@
+package hcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAllowlistMiddleware(t *testing.T) {
+	mw, err := IPAllowlistMiddleware([]string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"}, "172.16.0.1")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tcs := []struct {
+		remoteAddr string
+		xff        string
+		expected   int
+	}{
+		{"10.1.2.3:1234", "", http.StatusOK},
+		{"192.168.1.5:1234", "", http.StatusOK},
+		{"192.168.1.6:1234", "", http.StatusForbidden},
+		{"[fd00::1]:1234", "", http.StatusOK},
+		{"203.0.113.1:1234", "10.1.2.3", http.StatusForbidden},
+		{"172.16.0.1:1234", "10.1.2.3", http.StatusOK},
+		{"172.16.0.1:1234", "10.1.2.3, 203.0.113.1", http.StatusForbidden},
+		{"172.16.0.1:1234", "203.0.113.1, 10.1.2.3", http.StatusOK},
+		{"172.16.0.1:1234", "10.1.2.3, 172.16.0.1", http.StatusOK},
+		{"172.16.0.1:1234", "garbage", http.StatusForbidden},
+		{"172.16.0.1:1234", "", http.StatusForbidden},
+	}
+
+	for _, tc := range tcs {
+		req := httptest.NewRequest(http.MethodGet, "/_hcheck", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.expected {
+			t.Fatalf("Expected status code of '%s' '%s' to equal '%d', got '%d'", tc.remoteAddr, tc.xff, tc.expected, rec.Code)
+		}
+	}
+}
+
+func TestIPAllowlistMiddleware_Invalid(t *testing.T) {
+	if _, err := IPAllowlistMiddleware([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatalf("Expected an error for a malformed CIDR")
+	}
+	if _, err := IPAllowlistMiddleware([]string{"10.0.0.0/8"}, "proxy"); err == nil {
+		t.Fatalf("Expected an error for a malformed trusted proxy")
+	}
+}
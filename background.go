@@ -0,0 +1,79 @@
+package hcheck
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// BackgroundJitter represents the fraction by which every interval of
+// StartBackground is randomly lengthened or shortened, so a fleet of instances
+// started together doesn't probe shared dependencies in lockstep. A value of
+// 0.1 spreads the runs over ±10% of the interval. A value of zero disables the
+// jitter. Values of 1 or more, which could shorten an interval to nothing,
+// are capped at maxJitter.
+var BackgroundJitter = 0.1
+
+// maxJitter represents the largest fraction of jitter applied to an interval.
+const maxJitter = 0.9
+
+// RandFloat64 returns a pseudo-random number in [0.0,1.0), which is the source
+// of any randomness, such as the BackgroundJitter. It defaults to the global
+// source of math/rand, and can be replaced, e.g. by the Float64 method of a
+// rand.Rand with a fixed seed, to make the timing reproducible in tests.
+var RandFloat64 = rand.Float64
+
+// StartBackground runs all registered tests every interval until the returned
+// function is called, starting right away. The results are tracked like the
+// ones of a request running every test, so they're available through Snapshot
+// and trigger OnStatusChange. It panics when the interval isn't positive.
+func StartBackground(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		panic("Background interval " + interval.String() + " isn't positive")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			if hc, err := check(ctx, registeredTests(), Timeout); err == nil {
+				trackStatus(hc)
+			}
+
+			// the next run is scheduled from the end of this one, so a slow
+			// run can't cause runs to pile up
+			timer.Reset(jitter(interval, BackgroundJitter))
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// jitter returns the interval randomly lengthened or shortened by up to the
+// given fraction of it.
+func jitter(interval time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return interval
+	}
+	if fraction > maxJitter {
+		fraction = maxJitter
+	}
+
+	delta := time.Duration(float64(interval) * fraction * (2*RandFloat64() - 1))
+	return interval + delta
+}
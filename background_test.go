@@ -0,0 +1,106 @@
+package hcheck
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartBackground(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+
+	var runs int32
+	RegisterTest("counting", func(_ context.Context) (Status, error) {
+		atomic.AddInt32(&runs, 1)
+		return Degraded, nil
+	})
+
+	stop := StartBackground(10 * time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runs) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+
+	if n := atomic.LoadInt32(&runs); n < 3 {
+		t.Fatalf("Expected at least '%d' runs, got '%d'", 3, n)
+	}
+	if s := Snapshot().Status; s != Degraded {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Degraded, s)
+	}
+
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(50 * time.Millisecond)
+	if m := atomic.LoadInt32(&runs); m != n {
+		t.Fatalf("Expected no runs after stopping, got '%d'", m-n)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	interval := time.Second
+
+	if d := jitter(interval, 0); d != interval {
+		t.Fatalf("Expected interval to equal '%s', got '%s'", interval, d)
+	}
+
+	min, max := 900*time.Millisecond, 1100*time.Millisecond
+	for i := 0; i < 1000; i++ {
+		if d := jitter(interval, 0.1); d < min || d > max {
+			t.Fatalf("Expected interval between '%s' and '%s', got '%s'", min, max, d)
+		}
+	}
+}
+
+func TestJitter_Clamp(t *testing.T) {
+	defer func() {
+		RandFloat64 = rand.Float64
+	}()
+
+	RandFloat64 = func() float64 {
+		return 0
+	}
+
+	interval := time.Second
+	for _, fraction := range []float64{1, 2.5} {
+		if d := jitter(interval, fraction); d != 100*time.Millisecond {
+			t.Fatalf("Expected interval to equal '%s', got '%s'", 100*time.Millisecond, d)
+		}
+	}
+}
+
+func TestStartBackground_InvalidInterval(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("Expected a non-positive interval to panic")
+		}
+	}()
+	StartBackground(0)
+}
+
+func TestJitter_RandFloat64(t *testing.T) {
+	defer func() {
+		RandFloat64 = rand.Float64
+	}()
+
+	interval := time.Second
+	for _, tc := range []struct {
+		r        float64
+		expected time.Duration
+	}{
+		{0, 900 * time.Millisecond},
+		{0.5, interval},
+		{0.75, 1050 * time.Millisecond},
+	} {
+		RandFloat64 = func() float64 {
+			return tc.r
+		}
+
+		if d := jitter(interval, 0.1); d != tc.expected {
+			t.Fatalf("Expected interval to equal '%s', got '%s'", tc.expected, d)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package hcheck
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is attached to a test which wasn't executed because its
+// circuit breaker is open.
+var ErrBreakerOpen = Error("circuit breaker is open")
+
+// The states of a circuit breaker, as reported in Test.Breaker.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// breaker represents a circuit breaker which stops executing a test after it
+// failed threshold times in a row. Once the cooldown has passed, a single
+// trial run is allowed to decide whether to close the breaker again.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// WithBreaker wraps the test in a circuit breaker. After threshold consecutive
+// failures, which are Unavailable results and timeouts whatever the
+// TimeoutStatus, the breaker opens and the test reports Unavailable without
+// being executed. Once the cooldown has passed, a single trial run decides
+// whether the breaker closes or stays open for another cooldown. The state of
+// the breaker is reported in Test.Breaker.
+func WithBreaker(threshold int, cooldown time.Duration) TestOption {
+	return func(reg *registration) {
+		reg.breaker = &breaker{
+			threshold: threshold,
+			cooldown:  cooldown,
+			state:     BreakerClosed,
+		}
+	}
+}
+
+// allow reports whether the test may be executed, along with the state of the
+// breaker.
+func (b *breaker) allow() (bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = BreakerHalfOpen
+		return true, b.state
+	}
+
+	return b.state == BreakerClosed, b.state
+}
+
+// record records whether an executed test failed and returns the new state of
+// the breaker.
+func (b *breaker) record(failed bool) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return b.state
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+
+	return b.state
+}
+
+// abort records that an executed test was canceled before it could tell
+// whether it failed, and returns the state of the breaker. A canceled trial
+// returns the breaker to open without starting another cooldown, so the next
+// run is a trial again.
+func (b *breaker) abort() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+
+	return b.state
+}
@@ -0,0 +1,175 @@
+package hcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	defer resetTests()
+
+	calls := 0
+	status := Unavailable
+	RegisterTest("flaky", func(_ context.Context) (Status, error) {
+		calls++
+		if status == Unavailable {
+			return status, errors.New("unavailable")
+		}
+		return status, nil
+	}, WithBreaker(2, 100*time.Millisecond))
+
+	expect := func(breaker string, n int, err Error) {
+		t.Helper()
+
+		hc, _, e := getHealth()
+		if e != nil {
+			t.Fatalf("Expected no error, got '%s'", e.Error())
+		}
+		if b := hc.Tests["flaky"].Breaker; b != breaker {
+			t.Fatalf("Expected breaker to equal '%s', got '%s'", breaker, b)
+		}
+		if calls != n {
+			t.Fatalf("Expected '%d' calls, got '%d'", n, calls)
+		}
+		if e := hc.Tests["flaky"].Error; e != err {
+			t.Fatalf("Expected error to equal '%s', got '%s'", err, e)
+		}
+	}
+
+	expect(BreakerClosed, 1, "unavailable")
+	expect(BreakerOpen, 2, "unavailable")
+
+	// while open, the test isn't executed
+	expect(BreakerOpen, 2, ErrBreakerOpen)
+
+	// after the cooldown, a failing trial opens the breaker again
+	time.Sleep(100 * time.Millisecond)
+	expect(BreakerOpen, 3, "unavailable")
+	expect(BreakerOpen, 3, ErrBreakerOpen)
+
+	// and a passing trial closes it
+	time.Sleep(100 * time.Millisecond)
+	status = Available
+	expect(BreakerClosed, 4, "")
+}
+
+func TestBreaker_Timeout(t *testing.T) {
+	defer resetTests()
+
+	TimeoutStatus = TimedOut
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		<-ctx.Done()
+		return Available, nil
+	}, WithTimeout(10*time.Millisecond), WithBreaker(2, time.Minute))
+
+	for _, expected := range []string{BreakerClosed, BreakerOpen} {
+		hc, _, err := getHealth()
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if tst := hc.Tests["slow"]; tst.Status != TimedOut || tst.Breaker != expected {
+			t.Fatalf("Expected '%s' with breaker '%s', got '%+v'", TimedOut, expected, tst)
+		}
+	}
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if e := hc.Tests["slow"].Error; e != ErrBreakerOpen {
+		t.Fatalf("Expected error to equal '%s', got '%s'", ErrBreakerOpen, e)
+	}
+}
+
+func TestBreaker_Canceled(t *testing.T) {
+	defer resetTests()
+
+	healthy := make(chan struct{})
+	RegisterTest("flaky", func(ctx context.Context) (Status, error) {
+		select {
+		case <-ctx.Done():
+			return Unavailable, ctx.Err()
+		case <-healthy:
+			return Available, nil
+		}
+	}, WithBreaker(1, time.Minute))
+
+	// the client goes away while the test runs, twice
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/_hcheck", nil).WithContext(ctx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		NewHandler(http.NewServeMux()).ServeHTTP(httptest.NewRecorder(), req)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	close(healthy)
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if tst := hc.Tests["flaky"]; tst.Status != Available || tst.Breaker != BreakerClosed {
+		t.Fatalf("Expected '%s' with breaker '%s', got '%+v'", Available, BreakerClosed, tst)
+	}
+}
+
+func TestBreaker_FailFast(t *testing.T) {
+	defer resetTests()
+
+	FailFast = true
+
+	var failing int32 = 1
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		if atomic.LoadInt32(&failing) == 1 {
+			return Unavailable, errors.New("connection refused")
+		}
+		return Available, nil
+	})
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		select {
+		case <-ctx.Done():
+			return Unavailable, ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+			return Available, nil
+		}
+	}, WithBreaker(1, time.Minute))
+
+	// the failing test cancels the healthy one, twice
+	for i := 0; i < 2; i++ {
+		if _, _, err := getHealth(); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	atomic.StoreInt32(&failing, 0)
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if tst := hc.Tests["slow"]; tst.Status != Available || tst.Breaker != BreakerClosed {
+		t.Fatalf("Expected '%s' with breaker '%s', got '%+v'", Available, BreakerClosed, tst)
+	}
+}
+
+func TestBreaker_CanceledTrial(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: time.Millisecond, state: BreakerClosed}
+	b.record(true)
+	openedAt := b.openedAt
+
+	time.Sleep(2 * time.Millisecond)
+	if ok, state := b.allow(); !ok || state != BreakerHalfOpen {
+		t.Fatalf("Expected a trial, got '%t' '%s'", ok, state)
+	}
+	if state := b.abort(); state != BreakerOpen || !b.openedAt.Equal(openedAt) {
+		t.Fatalf("Expected the breaker to reopen without a new cooldown, got '%s'", state)
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Fatalf("Expected another trial right away")
+	}
+}
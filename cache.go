@@ -0,0 +1,117 @@
+package hcheck
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// CacheTTL represents the duration the result of a run of all registered
+	// tests is reused for by the health endpoint, including the results of
+	// StartBackground, so frequent probes don't each hit the dependencies.
+	// Filtered requests always run their tests. A value of zero disables the
+	// cache.
+	CacheTTL time.Duration
+
+	// StaleWhileRevalidate serves an expired result of the CacheTTL right away,
+	// rather than having the request wait for the tests, while a single
+	// refresh runs in the background. Such a response is marked as Stale and
+	// carries a Warning header.
+	StaleWhileRevalidate = false
+)
+
+// revalidating is set while a refresh of StaleWhileRevalidate runs.
+var revalidating int32
+
+// fromCache returns the cached result for a request running the given tests.
+// It returns false when the request has to run the tests.
+func fromCache(tests map[string]*registration) (HealthCheck, bool) {
+	if CacheTTL <= 0 || len(tests) != len(registeredTests()) {
+		return HealthCheck{}, false
+	}
+
+	last, ok := latestCheck()
+	if !ok {
+		return HealthCheck{}, false
+	}
+
+	now := time.Now()
+	if now.Sub(last.CheckedAt) < CacheTTL {
+		return cached(last, now), true
+	}
+	if !StaleWhileRevalidate {
+		return HealthCheck{}, false
+	}
+
+	revalidate()
+	hc := cached(last, now)
+	hc.Stale = true
+	return hc, true
+}
+
+// revalidate refreshes the cached result in the background, unless a refresh
+// is running already.
+func revalidate() {
+	if !atomic.CompareAndSwapInt32(&revalidating, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&revalidating, 0)
+
+		if hc, err := check(context.Background(), registeredTests(), Timeout); err == nil {
+			trackStatus(hc)
+		}
+	}()
+}
+
+// Cached wraps the test so its result is reused for the given TTL, while the
+// other tests keep running on every request, for dependencies which are
+// expensive to probe. Concurrent calls share a single run of the test. A
+// result of a run whose context is done, such as when the request timed out,
+// isn't cached. The age of the result is reported in the details, along with
+// the details of the run it came from.
+func Cached(test TestFunc, ttl time.Duration) TestFunc {
+	c := &cachedTest{test: test, ttl: ttl, sem: make(chan struct{}, 1)}
+	return c.run
+}
+
+type cachedTest struct {
+	test TestFunc
+	ttl  time.Duration
+
+	// sem guards the fields below, while allowing callers waiting for a
+	// refresh to give up when their context is done
+	sem     chan struct{}
+	status  Status
+	err     error
+	details map[string]interface{}
+	at      time.Time
+}
+
+func (c *cachedTest) run(ctx context.Context) (Status, error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return Unavailable, ctx.Err()
+	}
+	defer func() { <-c.sem }()
+
+	if c.at.IsZero() || time.Since(c.at) >= c.ttl {
+		d := &details{}
+		status, err := c.test(context.WithValue(ctx, detailsKey{}, d))
+		if ctx.Err() != nil {
+			return status, err
+		}
+
+		c.status, c.err, c.details, c.at = status, err, d.get(), time.Now()
+	}
+
+	for k, v := range c.details {
+		SetDetail(ctx, k, v)
+	}
+	SetDetail(ctx, "cache_age_ms", int64(time.Since(c.at)/time.Millisecond))
+
+	return c.status, c.err
+}
@@ -0,0 +1,139 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	var l sync.Mutex
+	calls := 0
+	check := Cached(func(ctx context.Context) (Status, error) {
+		l.Lock()
+		defer l.Unlock()
+		calls++
+		SetDetail(ctx, "calls", calls)
+		return Degraded, errors.New("slow")
+	}, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s, err := check(context.Background()); s != Degraded || err == nil {
+				t.Errorf("Expected status to equal '%s', got '%s' '%v'", Degraded, s, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("Expected '%d' calls, got '%d'", 1, calls)
+	}
+
+	d := &details{}
+	check(context.WithValue(context.Background(), detailsKey{}, d))
+	if v := d.get()["calls"]; v != 1 {
+		t.Fatalf("Expected the cached details to be reported, got '%v'", d.get())
+	}
+	if _, ok := d.get()["cache_age_ms"]; !ok {
+		t.Fatalf("Expected the cache age to be reported, got '%v'", d.get())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	check(context.Background())
+	if calls != 2 {
+		t.Fatalf("Expected '%d' calls, got '%d'", 2, calls)
+	}
+}
+
+func TestCached_Canceled(t *testing.T) {
+	calls := 0
+	check := Cached(func(ctx context.Context) (Status, error) {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return Unavailable, ctx.Err()
+		}
+		return Available, nil
+	}, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if s, _ := check(ctx); s != Unavailable {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Unavailable, s)
+	}
+
+	// the result of the canceled run isn't cached
+	if s, _ := check(context.Background()); s != Available {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Available, s)
+	}
+}
+
+func TestHealthChecks_CacheTTL(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+
+	CacheTTL = 50 * time.Millisecond
+	StaleWhileRevalidate = true
+
+	var calls int32
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		atomic.AddInt32(&calls, 1)
+		return Available, nil
+	})
+
+	srv := httptest.NewServer(NewHandler(nil))
+	defer srv.Close()
+
+	get := func() (HealthCheck, http.Header) {
+		rsp, err := http.Get(srv.URL + "/_hcheck")
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		var hc HealthCheck
+		if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return hc, rsp.Header
+	}
+
+	if hc, _ := get(); hc.Tests["db"].Cached {
+		t.Fatalf("Expected the first response to be fresh")
+	}
+	if hc, _ := get(); !hc.Tests["db"].Cached || hc.Stale {
+		t.Fatalf("Expected the second response to be cached, got '%+v'", hc)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("Expected '%d' calls, got '%d'", 1, n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	hc, header := get()
+	if !hc.Stale {
+		t.Fatalf("Expected the expired response to be stale")
+	}
+	if h := strings.Join(header["Warning"], ", "); !strings.Contains(h, "110") {
+		t.Fatalf("Expected a stale Warning header, got '%s'", h)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&revalidating) == 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("Expected the stale response to trigger a refresh, got '%d' calls", n)
+	}
+}
@@ -0,0 +1,300 @@
+package hcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cgroupMemoryLimits represents the files which hold the memory limit of the
+// cgroup, for cgroup v2 and v1 respectively.
+var cgroupMemoryLimits = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// startedAt represents when the package was initialized, which counts as the
+// last run until there has been one.
+var startedAt = time.Now()
+
+// MemoryCheck returns a TestFunc which reports Degraded once the allocated
+// heap reaches warnBytes, and Unavailable once it reaches critBytes. The heap
+// usage, and the memory limit of the cgroup when there is one, are reported in
+// the details.
+//
+// The check is built on runtime.ReadMemStats, which stops the world while it
+// runs. Probe it sparingly, e.g. by caching its result, rather than on every
+// request of a busy health endpoint.
+func MemoryCheck(warnBytes, critBytes uint64) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+
+		SetDetail(ctx, "heap_alloc_bytes", m.HeapAlloc)
+		SetDetail(ctx, "sys_bytes", m.Sys)
+		if limit, ok := cgroupMemoryLimit(); ok {
+			SetDetail(ctx, "cgroup_limit_bytes", limit)
+		}
+
+		switch {
+		case m.HeapAlloc >= critBytes:
+			return Unavailable, fmt.Errorf("heap usage of %d bytes exceeds %d bytes", m.HeapAlloc, critBytes)
+		case m.HeapAlloc >= warnBytes:
+			return Degraded, fmt.Errorf("heap usage of %d bytes exceeds %d bytes", m.HeapAlloc, warnBytes)
+		default:
+			return Available, nil
+		}
+	}
+}
+
+// FileCheck returns a TestFunc which reports Unavailable when the given path
+// doesn't exist. When mustBeWritable is set, it also has to be writable: for a
+// directory a temporary file is written to it and removed again, a file is
+// opened for writing without modifying it. The path, and the reason of a
+// failure, are reported in the details.
+func FileCheck(path string, mustBeWritable bool) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		SetDetail(ctx, "path", path)
+
+		if err := checkFile(path, mustBeWritable); err != nil {
+			SetDetail(ctx, "reason", err.Error())
+			return Unavailable, err
+		}
+
+		return Available, nil
+	}
+}
+
+func checkFile(path string, mustBeWritable bool) error {
+	fi, err := os.Stat(path)
+	if err != nil || !mustBeWritable {
+		return err
+	}
+
+	if !fi.IsDir() {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	f, err := os.CreateTemp(path, ".hcheck-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write([]byte("hcheck")); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func cgroupMemoryLimit() (uint64, bool) {
+	for _, file := range cgroupMemoryLimits {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		// cgroup v2 reports "max" when there's no limit
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		return limit, true
+	}
+
+	return 0, false
+}
+
+// ConfigCheck returns a TestFunc for a fast, synchronous invariant, such as a
+// required environment variable being set or the configuration being parsed,
+// reporting Unavailable with the error of fn when it doesn't hold. The name of
+// the invariant is reported in the details.
+func ConfigCheck(name string, fn func() error) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		SetDetail(ctx, "invariant", name)
+
+		if err := fn(); err != nil {
+			return Unavailable, fmt.Errorf("%s: %v", name, err)
+		}
+
+		return Available, nil
+	}
+}
+
+// FreshnessCheck returns a TestFunc which reports Unavailable when the last run
+// of all registered tests, such as by StartBackground, is older than maxAge,
+// catching a background loop which silently stopped. Until the first run, the
+// age is counted from the start of the process. The age is reported in the
+// details.
+func FreshnessCheck(maxAge time.Duration) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		last := startedAt
+		if hc, ok := latestCheck(); ok {
+			last = hc.CheckedAt
+		}
+
+		age := time.Since(last)
+		SetDetail(ctx, "age_ms", int64(age/time.Millisecond))
+		if age > maxAge {
+			return Unavailable, fmt.Errorf("last run %s ago exceeds %s", age.Round(time.Millisecond), maxAge)
+		}
+
+		return Available, nil
+	}
+}
+
+// HeartbeatCheck returns a TestFunc which reports Unavailable when the last
+// heartbeat of a background worker, as returned by lastBeat, is older than
+// maxAge, surfacing a stuck worker which the process being alive doesn't
+// reveal. The worker records its heartbeat whenever it makes progress, e.g. in
+// an atomic value read by lastBeat. Until the first heartbeat, a zero time, the
+// age is counted from the start of the process. The age is reported in the
+// details.
+func HeartbeatCheck(lastBeat func() time.Time, maxAge time.Duration) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		last := lastBeat()
+		if last.IsZero() {
+			last = startedAt
+		}
+
+		age := time.Since(last)
+		SetDetail(ctx, "age_ms", int64(age/time.Millisecond))
+		if age > maxAge {
+			return Unavailable, fmt.Errorf("last heartbeat %s ago exceeds %s", age.Round(time.Millisecond), maxAge)
+		}
+
+		return Available, nil
+	}
+}
+
+// TimeSkewCheck returns a TestFunc which compares the local clock to the time
+// returned by the reference, such as HTTPDateReference, and reports Degraded
+// when they differ by more than maxSkew, and Unavailable by more than twice
+// that, as a skewed clock breaks authentication and TLS. The time the reference
+// takes to respond is accounted for by comparing to the middle of the call.
+// The measured skew is reported in the details. A failing reference is
+// Degraded, as the skew can't be measured.
+func TimeSkewCheck(reference func(ctx context.Context) (time.Time, error), maxSkew time.Duration) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		start := time.Now()
+		ref, err := reference(ctx)
+		if err != nil {
+			return Degraded, fmt.Errorf("time reference: %s", err)
+		}
+		local := start.Add(time.Since(start) / 2)
+
+		skew := local.Sub(ref)
+		SetDetail(ctx, "skew_ms", int64(skew/time.Millisecond))
+		if skew < 0 {
+			skew = -skew
+		}
+
+		switch {
+		case skew > 2*maxSkew:
+			return Unavailable, fmt.Errorf("clock skew of %s exceeds %s", skew.Round(time.Millisecond), 2*maxSkew)
+		case skew > maxSkew:
+			return Degraded, fmt.Errorf("clock skew of %s exceeds %s", skew.Round(time.Millisecond), maxSkew)
+		}
+
+		return Available, nil
+	}
+}
+
+// HTTPDateReference returns a reference for TimeSkewCheck which takes the time
+// from the Date header of a HEAD request to the given URL of a trusted server.
+// The header has a resolution of a second, so maxSkew should be well above
+// that.
+func HTTPDateReference(url string) func(ctx context.Context) (time.Time, error) {
+	return func(ctx context.Context) (time.Time, error) {
+		req, err := http.NewRequest(http.MethodHead, url, nil)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return time.Time{}, err
+		}
+		rsp.Body.Close()
+
+		return http.ParseTime(rsp.Header.Get("Date"))
+	}
+}
+
+// WithLatencyThresholds wraps the test so it's timed, catching dependencies
+// which are slow but working. It reports Degraded when the test takes warn or
+// longer, and Unavailable when it takes crit or longer, unless the test itself
+// reports a worse status. The latency is reported in the details.
+func WithLatencyThresholds(test TestFunc, warn, crit time.Duration) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		start := time.Now()
+		status, err := test(ctx)
+		latency := time.Since(start)
+
+		SetDetail(ctx, "latency_ms", int64(latency/time.Millisecond))
+
+		threshold, downgraded := time.Duration(0), status
+		switch {
+		case latency >= crit:
+			threshold, downgraded = crit, Unavailable
+		case latency >= warn:
+			threshold, downgraded = warn, Degraded
+		}
+		if rank(downgraded) <= rank(status) {
+			return status, err
+		}
+
+		if err == nil {
+			err = fmt.Errorf("latency of %s exceeds %s", latency.Round(time.Millisecond), threshold)
+		}
+		return downgraded, err
+	}
+}
+
+// WithSlowWarning wraps the test so a run taking threshold or longer is
+// annotated with a warning in the details, including the measured duration and
+// the threshold, to spot creeping latency early. Unlike WithLatencyThresholds,
+// the status of the test is left untouched.
+func WithSlowWarning(test TestFunc, threshold time.Duration) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		start := time.Now()
+		status, err := test(ctx)
+		if d := time.Since(start); d >= threshold {
+			SetDetail(ctx, "slow_warning", fmt.Sprintf("took %s, exceeding %s", d.Round(time.Millisecond), threshold))
+		}
+
+		return status, err
+	}
+}
+
+// RecoverAs wraps the test so a panic is reported with the given status, e.g.
+// Degraded for a non-critical subsystem, rather than as Unavailable. The error
+// includes the recovered value, and the details its stack trace when
+// IncludeStackTraces is set.
+func RecoverAs(test TestFunc, status Status) TestFunc {
+	return func(ctx context.Context) (s Status, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				s, err = status, fmt.Errorf("panic: %v", r)
+				if IncludeStackTraces {
+					SetDetail(ctx, "stack", string(debug.Stack()))
+				}
+			}
+		}()
+
+		return test(ctx)
+	}
+}
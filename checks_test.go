@@ -0,0 +1,292 @@
+package hcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCheck(t *testing.T) {
+	defer resetTests()
+
+	tcs := []struct {
+		name       string
+		warn, crit uint64
+		status     Status
+	}{
+		{"memory-ok", 1 << 62, 1 << 63, Available},
+		{"memory-warn", 1, 1 << 63, Degraded},
+		{"memory-crit", 1, 1, Unavailable},
+	}
+
+	for _, tc := range tcs {
+		RegisterTest(tc.name, MemoryCheck(tc.warn, tc.crit))
+	}
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	for _, tc := range tcs {
+		tst := hc.Tests[tc.name]
+		if tst.Status != tc.status {
+			t.Fatalf("Expected '%s' to equal '%s', got '%s'", tc.name, tc.status, tst.Status)
+		}
+		if _, ok := tst.Details["heap_alloc_bytes"]; !ok {
+			t.Fatalf("Expected '%s' to report the heap usage, got '%v'", tc.name, tst.Details)
+		}
+	}
+}
+
+func TestFileCheck(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "lock")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	readOnly := filepath.Join(dir, "readonly")
+	if err := os.WriteFile(readOnly, nil, 0400); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	type testCase struct {
+		path     string
+		writable bool
+		status   Status
+	}
+
+	tcs := []testCase{
+		{dir, false, Available},
+		{dir, true, Available},
+		{file, true, Available},
+		{filepath.Join(dir, "missing"), false, Unavailable},
+	}
+	if os.Geteuid() != 0 {
+		// root can write to anything
+		tcs = append(tcs, testCase{readOnly, true, Unavailable})
+	}
+
+	for _, tc := range tcs {
+		if s, err := FileCheck(tc.path, tc.writable)(context.Background()); s != tc.status {
+			t.Fatalf("Expected '%s' to equal '%s', got '%s' (%v)", tc.path, tc.status, s, err)
+		}
+	}
+
+	// the temporary file is cleaned up
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if ln := len(entries); ln != 2 {
+		t.Fatalf("Expected '%d' entries, got '%d'", 2, ln)
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	check := ConfigCheck("DATABASE_URL", func() error {
+		if os.Getenv("HCHECK_TEST_DATABASE_URL") == "" {
+			return errors.New("not set")
+		}
+		return nil
+	})
+
+	s, err := check(context.Background())
+	if s != Unavailable || err == nil || err.Error() != "DATABASE_URL: not set" {
+		t.Fatalf("Expected status to equal '%s' with 'DATABASE_URL: not set', got '%s' '%v'", Unavailable, s, err)
+	}
+
+	os.Setenv("HCHECK_TEST_DATABASE_URL", "postgres://localhost")
+	defer os.Unsetenv("HCHECK_TEST_DATABASE_URL")
+
+	if s, err := check(context.Background()); s != Available || err != nil {
+		t.Fatalf("Expected status to equal '%s', got '%s' '%v'", Available, s, err)
+	}
+}
+
+func TestFreshnessCheck(t *testing.T) {
+	resetNotify()
+	defer resetNotify()
+
+	check := FreshnessCheck(time.Minute)
+
+	// until the first run the age is counted from the start of the process
+	if s, err := check(context.Background()); s != Available || err != nil {
+		t.Fatalf("Expected status to equal '%s', got '%s' '%v'", Available, s, err)
+	}
+
+	trackStatus(HealthCheck{CheckedAt: time.Now().Add(-2 * time.Minute), Status: Available})
+	if s, err := check(context.Background()); s != Unavailable || err == nil {
+		t.Fatalf("Expected status to equal '%s', got '%s' '%v'", Unavailable, s, err)
+	}
+
+	trackStatus(HealthCheck{CheckedAt: time.Now(), Status: Available})
+	if s, err := check(context.Background()); s != Available || err != nil {
+		t.Fatalf("Expected status to equal '%s', got '%s' '%v'", Available, s, err)
+	}
+}
+
+func TestHeartbeatCheck(t *testing.T) {
+	var beat time.Time
+	check := HeartbeatCheck(func() time.Time { return beat }, time.Minute)
+
+	// until the first heartbeat the age is counted from the start of the process
+	if s, err := check(context.Background()); s != Available || err != nil {
+		t.Fatalf("Expected status to equal '%s', got '%s' '%v'", Available, s, err)
+	}
+
+	beat = time.Now().Add(-2 * time.Minute)
+	d := &details{}
+	if s, err := check(context.WithValue(context.Background(), detailsKey{}, d)); s != Unavailable || err == nil {
+		t.Fatalf("Expected status to equal '%s', got '%s' '%v'", Unavailable, s, err)
+	}
+	if age, _ := d.get()["age_ms"].(int64); age < int64(2*time.Minute/time.Millisecond) {
+		t.Fatalf("Expected the age in the details, got '%v'", d.get())
+	}
+
+	beat = time.Now()
+	if s, err := check(context.Background()); s != Available || err != nil {
+		t.Fatalf("Expected status to equal '%s', got '%s' '%v'", Available, s, err)
+	}
+}
+
+func TestWithLatencyThresholds(t *testing.T) {
+	sleeping := func(d time.Duration, status Status) TestFunc {
+		return func(_ context.Context) (Status, error) {
+			time.Sleep(d)
+			return status, nil
+		}
+	}
+
+	tcs := []struct {
+		test     TestFunc
+		expected Status
+	}{
+		{sleeping(0, Available), Available},
+		{sleeping(30*time.Millisecond, Available), Degraded},
+		{sleeping(60*time.Millisecond, Available), Unavailable},
+		{sleeping(30*time.Millisecond, Unavailable), Unavailable},
+	}
+
+	for _, tc := range tcs {
+		check := WithLatencyThresholds(tc.test, 20*time.Millisecond, 50*time.Millisecond)
+		s, err := check(context.Background())
+		if s != tc.expected {
+			t.Fatalf("Expected status to equal '%s', got '%s'", tc.expected, s)
+		}
+		if s == Degraded && err == nil {
+			t.Fatalf("Expected an error explaining the downgrade")
+		}
+	}
+}
+
+func TestWithSlowWarning(t *testing.T) {
+	for _, tc := range []struct {
+		sleep time.Duration
+		warns bool
+	}{
+		{0, false},
+		{30 * time.Millisecond, true},
+	} {
+		check := WithSlowWarning(func(_ context.Context) (Status, error) {
+			time.Sleep(tc.sleep)
+			return Unavailable, errors.New("unavailable")
+		}, 20*time.Millisecond)
+
+		d := &details{}
+		s, err := check(context.WithValue(context.Background(), detailsKey{}, d))
+		if s != Unavailable || err == nil {
+			t.Fatalf("Expected the status to be left untouched, got '%s' '%v'", s, err)
+		}
+
+		warning, ok := d.get()["slow_warning"].(string)
+		if ok != tc.warns {
+			t.Fatalf("Expected a warning to be '%t', got '%v'", tc.warns, d.get())
+		}
+		if ok && !strings.Contains(warning, "exceeding 20ms") {
+			t.Fatalf("Expected the warning to include the threshold, got '%s'", warning)
+		}
+	}
+}
+
+func TestRecoverAs(t *testing.T) {
+	check := RecoverAs(func(_ context.Context) (Status, error) {
+		panic("helper crashed")
+	}, Degraded)
+
+	s, err := check(context.Background())
+	if s != Degraded {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Degraded, s)
+	}
+	if err == nil || err.Error() != "panic: helper crashed" {
+		t.Fatalf("Expected error to equal '%s', got '%v'", "panic: helper crashed", err)
+	}
+
+	check = RecoverAs(func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("unavailable")
+	}, Degraded)
+	if s, _ := check(context.Background()); s != Unavailable {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Unavailable, s)
+	}
+}
+
+func TestTimeSkewCheck(t *testing.T) {
+	tcs := []struct {
+		skew     time.Duration
+		err      error
+		expected Status
+	}{
+		{0, nil, Available},
+		{-3 * time.Second, nil, Degraded},
+		{3 * time.Second, nil, Degraded},
+		{-5 * time.Second, nil, Unavailable},
+		{0, errors.New("unreachable"), Degraded},
+	}
+
+	for _, tc := range tcs {
+		check := TimeSkewCheck(func(_ context.Context) (time.Time, error) {
+			return time.Now().Add(tc.skew), tc.err
+		}, 2*time.Second)
+
+		d := &details{}
+		s, err := check(context.WithValue(context.Background(), detailsKey{}, d))
+		if s != tc.expected {
+			t.Fatalf("Expected status to equal '%s', got '%s' '%v'", tc.expected, s, err)
+		}
+		if tc.err != nil {
+			continue
+		}
+
+		skew, ok := d.get()["skew_ms"].(int64)
+		if !ok {
+			t.Fatalf("Expected the skew in the details, got '%v'", d.get())
+		}
+		if want := -int64(tc.skew / time.Millisecond); skew > want+100 || skew < want-100 {
+			t.Fatalf("Expected a skew of about '%d', got '%d'", want, skew)
+		}
+	}
+}
+
+func TestHTTPDateReference(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ref, err := HTTPDateReference(srv.URL)(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if d := time.Since(ref); d < -time.Second || d > 2*time.Second {
+		t.Fatalf("Expected the reference to be close to now, got '%s'", ref)
+	}
+}
+
+func TestSetDetail(t *testing.T) {
+	// setting a detail outside of a test is a no-op
+	SetDetail(context.Background(), "key", "value")
+}
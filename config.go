@@ -0,0 +1,119 @@
+package hcheck
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Configuration represents the effective configuration of the health check.
+type Configuration struct {
+	Prefix               string        `json:"prefix"`
+	Endpoint             string        `json:"endpoint"`
+	Timeout              time.Duration `json:"timeout"`
+	TimeoutStatus        Status        `json:"timeout_status"`
+	TimeoutSeverity      Status        `json:"timeout_severity"`
+	MaxBodyBytes         int           `json:"max_body_bytes"`
+	HistorySize          int           `json:"history_size"`
+	CacheTTL             time.Duration `json:"cache_ttl"`
+	StaleWhileRevalidate bool          `json:"stale_while_revalidate"`
+	MaxConcurrency       int           `json:"max_concurrency"`
+	Tests                []string      `json:"tests"`
+
+	// Aggregator represents the name of the function set as Aggregate, such
+	// as "CompositeAggregator.Aggregate", or "worst" when it's nil. It's only
+	// reported, NewFromEnv doesn't apply it.
+	Aggregator string `json:"aggregator"`
+}
+
+// Config returns the current configuration of the health check, including the
+// names of the registered tests. It's meant to verify the configuration has
+// been applied as intended.
+func Config() Configuration {
+	registered := registeredTests()
+	tests := make([]string, 0, len(registered))
+	for name := range registered {
+		tests = append(tests, name)
+	}
+	sort.Strings(tests)
+
+	aggregator := "worst"
+	if Aggregate != nil {
+		aggregator = funcName(Aggregate)
+	}
+
+	return Configuration{
+		Prefix:               Prefix,
+		Endpoint:             Endpoint,
+		Timeout:              Timeout,
+		TimeoutStatus:        TimeoutStatus,
+		TimeoutSeverity:      TimeoutSeverity,
+		MaxBodyBytes:         MaxBodyBytes,
+		HistorySize:          HistorySize,
+		CacheTTL:             CacheTTL,
+		StaleWhileRevalidate: StaleWhileRevalidate,
+		MaxConcurrency:       MaxConcurrency,
+		Tests:                tests,
+		Aggregator:           aggregator,
+	}
+}
+
+// funcName returns the name of the function without its package, such as
+// "CompositeAggregator.Aggregate" for a method value.
+func funcName(f interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	name = name[strings.LastIndex(name, "/")+1:]
+
+	return name[strings.Index(name, ".")+1:]
+}
+
+// EnvConfig represents the settings NewFromEnv applies.
+type EnvConfig struct {
+	Prefix   string
+	Endpoint string
+	Timeout  time.Duration
+}
+
+// Option represents an option of NewFromEnv, which modifies the settings
+// before they're applied, e.g.
+//
+//	func(c *hcheck.EnvConfig) { c.Timeout = time.Second }
+type Option func(*EnvConfig)
+
+// NewFromEnv returns a handler like NewHandler, after reading the Prefix, the
+// Endpoint and the Timeout from the HCHECK_PREFIX, HCHECK_ENDPOINT and
+// HCHECK_TIMEOUT environment variables, such as "/internal", "/health" and
+// "2s". The given options take precedence over the environment, which takes
+// precedence over the current values; an unset or empty variable leaves the
+// value unchanged. An invalid or non-positive HCHECK_TIMEOUT returns an error,
+// and leaves the configuration unchanged.
+func NewFromEnv(dh http.Handler, opts ...Option) (http.Handler, error) {
+	c := EnvConfig{Prefix: Prefix, Endpoint: Endpoint, Timeout: Timeout}
+
+	if v := os.Getenv("HCHECK_PREFIX"); v != "" {
+		c.Prefix = v
+	}
+	if v := os.Getenv("HCHECK_ENDPOINT"); v != "" {
+		c.Endpoint = v
+	}
+	if v := os.Getenv("HCHECK_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return nil, Error(fmt.Sprintf("invalid HCHECK_TIMEOUT %q", v))
+		}
+		c.Timeout = timeout
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	Prefix, Endpoint, Timeout = c.Prefix, c.Endpoint, c.Timeout
+	return NewHandler(dh), nil
+}
@@ -0,0 +1,115 @@
+package hcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	defer resetTests()
+
+	Timeout = time.Second
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		return Available, nil
+	})
+
+	cfg := Config()
+	if cfg.Endpoint != Endpoint {
+		t.Fatalf("Expected endpoint to equal '%s', got '%s'", Endpoint, cfg.Endpoint)
+	}
+	if cfg.Timeout != time.Second {
+		t.Fatalf("Expected timeout to equal '%s', got '%s'", time.Second, cfg.Timeout)
+	}
+	if expected := []string{"db", "default"}; !reflect.DeepEqual(cfg.Tests, expected) {
+		t.Fatalf("Expected tests to equal '%v', got '%v'", expected, cfg.Tests)
+	}
+	if cfg.Aggregator != "worst" {
+		t.Fatalf("Expected aggregator to equal '%s', got '%s'", "worst", cfg.Aggregator)
+	}
+
+	CacheTTL = time.Second
+	Aggregate = CompositeAggregator{}.Aggregate
+	cfg = Config()
+	if cfg.CacheTTL != time.Second {
+		t.Fatalf("Expected cache TTL to equal '%s', got '%s'", time.Second, cfg.CacheTTL)
+	}
+	if cfg.Aggregator != "CompositeAggregator.Aggregate" {
+		t.Fatalf("Expected aggregator to equal '%s', got '%s'", "CompositeAggregator.Aggregate", cfg.Aggregator)
+	}
+
+	Aggregate = alwaysAvailable
+	if a := Config().Aggregator; a != "alwaysAvailable" {
+		t.Fatalf("Expected aggregator to equal '%s', got '%s'", "alwaysAvailable", a)
+	}
+}
+
+func alwaysAvailable(map[string]Test) Status {
+	return Available
+}
+
+func TestNewFromEnv(t *testing.T) {
+	defer resetTests()
+	defer func(prefix, endpoint string) {
+		Prefix, Endpoint = prefix, endpoint
+	}(Prefix, Endpoint)
+
+	t.Setenv("HCHECK_PREFIX", "/internal")
+	t.Setenv("HCHECK_ENDPOINT", "/health")
+	t.Setenv("HCHECK_TIMEOUT", "2s")
+
+	h, err := NewFromEnv(http.NewServeMux(), func(c *EnvConfig) {
+		c.Endpoint = "/ready"
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if Prefix != "/internal" || Endpoint != "/ready" || Timeout != 2*time.Second {
+		t.Fatalf("Expected the environment and options to apply, got '%s' '%s' '%s'", Prefix, Endpoint, Timeout)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/internal/ready")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, rsp.StatusCode)
+	}
+
+	t.Setenv("HCHECK_TIMEOUT", "soon")
+	if _, err := NewFromEnv(http.NewServeMux()); err == nil {
+		t.Fatalf("Expected an error for an invalid timeout")
+	}
+	if Timeout != 2*time.Second {
+		t.Fatalf("Expected timeout to be left unchanged, got '%s'", Timeout)
+	}
+}
+
+func TestNewFromEnv_Options(t *testing.T) {
+	defer resetTests()
+	defer func(prefix, endpoint string) {
+		Prefix, Endpoint = prefix, endpoint
+	}(Prefix, Endpoint)
+
+	// every setting an option can express is applied
+	if n := reflect.TypeOf(EnvConfig{}).NumField(); n != 3 {
+		t.Fatalf("Expected the test to cover every field of EnvConfig, got '%d' fields", n)
+	}
+
+	_, err := NewFromEnv(http.NewServeMux(), func(c *EnvConfig) {
+		c.Prefix, c.Endpoint, c.Timeout = "/admin", "/status", 3*time.Second
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if Prefix != "/admin" || Endpoint != "/status" || Timeout != 3*time.Second {
+		t.Fatalf("Expected the options to apply, got '%s' '%s' '%s'", Prefix, Endpoint, Timeout)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !hcheck_nodefault
+
+package hcheck
+
+// By default, importing the package registers an always Available "default"
+// test, so the health endpoint responds with a test before any test has been
+// registered. Building with `-tags hcheck_nodefault` starts with an empty
+// registry instead, so only the registered tests appear in the response.
+func init() {
+	RegisterTest("default", defaultCheck)
+}
@@ -0,0 +1,28 @@
+//go:build !hcheck_nodefault
+
+package hcheck
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealthChecks_Default(t *testing.T) {
+	if _, ok := initialTests["default"]; !ok || len(initialTests) != 1 {
+		t.Fatalf("Expected only the default test to be registered on import, got '%d' tests", len(initialTests))
+	}
+
+	hc, sc, err := getHealth()
+
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	if sc != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, sc)
+	}
+
+	if ln := len(hc.Tests); ln != 1 {
+		t.Fatalf("Expected '%d' tests, got '%d'", 1, ln)
+	}
+}
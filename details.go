@@ -0,0 +1,65 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+type detailsKey struct{}
+
+// details represents the details a test attached to its result.
+type details struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func (d *details) set(key string, value interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.values == nil {
+		d.values = map[string]interface{}{}
+	}
+	d.values[key] = value
+}
+
+func (d *details) get() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.values
+}
+
+// sanitized returns a copy of the details, in which the values which can't be
+// encoded as JSON, such as a channel or a func, are replaced by a note, so a
+// single careless detail doesn't break the whole response.
+func (d *details) sanitized() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.values == nil {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(d.values))
+	for key, value := range d.values {
+		if _, err := json.Marshal(value); err != nil {
+			value = fmt.Sprintf("unencodable %T: %s", value, err)
+		}
+		values[key] = value
+	}
+
+	return values
+}
+
+// SetDetail attaches a detail to the result of the test the context was
+// passed to, which is reported in Test.Details. It's safe to call from
+// multiple goroutines and does nothing when the context doesn't belong to a
+// test.
+func SetDetail(ctx context.Context, key string, value interface{}) {
+	if d, ok := ctx.Value(detailsKey{}).(*details); ok {
+		d.set(key, value)
+	}
+}
@@ -0,0 +1,35 @@
+package hcheck
+
+import "sort"
+
+// TestChange represents a test whose status changed between two health checks.
+// From is empty for a test which was added, and To for one which was removed.
+type TestChange struct {
+	Name string `json:"name"`
+	From Status `json:"from,omitempty"`
+	To   Status `json:"to,omitempty"`
+}
+
+// Diff returns the tests whose status changed from the previous to the current
+// health check, ordered by name, such as to alert on a single test changing
+// while the overall status stays the same. It returns nil when no test
+// changed.
+func Diff(prev, cur HealthCheck) []TestChange {
+	var changes []TestChange
+	for name, t := range cur.Tests {
+		if p, ok := prev.Tests[name]; !ok || p.Status != t.Status {
+			changes = append(changes, TestChange{Name: name, From: p.Status, To: t.Status})
+		}
+	}
+	for name, p := range prev.Tests {
+		if _, ok := cur.Tests[name]; !ok {
+			changes = append(changes, TestChange{Name: name, From: p.Status})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
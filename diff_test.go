@@ -0,0 +1,32 @@
+package hcheck
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	prev := HealthCheck{Tests: map[string]Test{
+		"db":    {Status: Available},
+		"cache": {Status: Degraded},
+		"queue": {Status: Available},
+	}}
+	cur := HealthCheck{Tests: map[string]Test{
+		"db":     {Status: Unavailable},
+		"cache":  {Status: Degraded},
+		"search": {Status: Available},
+	}}
+
+	expected := []TestChange{
+		{Name: "db", From: Available, To: Unavailable},
+		{Name: "queue", From: Available},
+		{Name: "search", To: Available},
+	}
+	if changes := Diff(prev, cur); !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Expected changes to equal '%v', got '%v'", expected, changes)
+	}
+
+	if changes := Diff(cur, cur); changes != nil {
+		t.Fatalf("Expected no changes, got '%v'", changes)
+	}
+}
@@ -0,0 +1,36 @@
+package hcheck
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// draining is set once Drain has been called.
+var draining int32
+
+// Drain marks the service as draining, such as on SIGTERM during a deploy, so
+// the DrainCheck reports Unavailable and the instance is taken out of rotation
+// while in-flight requests complete. It can't be undone.
+func Drain() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+// Draining returns whether Drain has been called.
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// DrainCheck returns a TestFunc which reports Unavailable once the service is
+// draining, so the response tells why readiness fails during a deploy. It's
+// meant to be registered with RegisterTest, or RegisterFor the readiness
+// endpoints, without the LivenessTag, so draining never fails a liveness
+// probe and gets the instance restarted before it's done.
+func DrainCheck() TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		if Draining() {
+			return Unavailable, ErrDraining
+		}
+
+		return Available, nil
+	}
+}
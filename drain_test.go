@@ -0,0 +1,52 @@
+package hcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDrainCheck(t *testing.T) {
+	defer resetTests()
+	defer atomic.StoreInt32(&draining, 0)
+
+	RegisterTest("drain", DrainCheck())
+	RegisterTest("worker", func(_ context.Context) (Status, error) {
+		return Available, nil
+	}, WithTags(LivenessTag))
+
+	hc, code, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if code != http.StatusOK || hc.Tests["drain"].Status != Available {
+		t.Fatalf("Expected an available response, got '%d' '%s'", code, hc.Tests["drain"].Status)
+	}
+
+	Drain()
+
+	hc, code, err = getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, code)
+	}
+	if tst := hc.Tests["drain"]; tst.Status != Unavailable || tst.Error != ErrDraining {
+		t.Fatalf("Expected test '%s' to be '%s' with '%s', got '%s' '%s'", "drain", Unavailable, ErrDraining, tst.Status, tst.Error)
+	}
+
+	srv := httptest.NewServer(LivenessHandler())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected liveness to be unaffected, got '%d'", rsp.StatusCode)
+	}
+}
@@ -0,0 +1,137 @@
+package hcheck
+
+import "errors"
+
+// StatusError represents an error which carries the status of the test it's
+// returned from. When a test returns several errors, its status is the worst
+// of the returned status and the statuses carried by its errors.
+type StatusError struct {
+	Status Status
+	Err    error
+}
+
+// WithStatus wraps the error so it carries the given status.
+func WithStatus(err error, status Status) error {
+	return &StatusError{Status: status, Err: err}
+}
+
+// Error returns the message of the wrapped error.
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// CodedError represents an error which carries a machine-readable code, such
+// as DB_CONN_REFUSED, which is reported in Test.Code.
+type CodedError struct {
+	Code string
+	Err  error
+}
+
+// WithCode wraps the error so it carries the given code.
+func WithCode(err error, code string) error {
+	return &CodedError{Code: code, Err: err}
+}
+
+// Error returns the message of the wrapped error.
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCodeError represents an error which suggests the HTTP status code the
+// health check responds with, such as 429 when a rate-limited upstream is the
+// cause of the failure. The suggestion only applies when the test is deciding
+// the overall status: it has failed and its status equals the overall status.
+// When several deciding tests suggest a code, the one of the test whose name
+// sorts first wins. Without a deciding suggestion, the default mapping
+// applies. A code outside of 200-599 is ignored.
+type StatusCodeError struct {
+	StatusCode int
+	Err        error
+}
+
+// WithStatusCode wraps the error so it suggests the given HTTP status code. A
+// code outside of 200-599 can't end a response, so the error is returned as
+// is rather than wrapped.
+func WithStatusCode(err error, code int) error {
+	if !validStatusCode(code) {
+		return err
+	}
+
+	return &StatusCodeError{StatusCode: code, Err: err}
+}
+
+// validStatusCode returns whether the HTTP status code can end a response.
+// Informational 1xx codes can't, the final response would still follow.
+func validStatusCode(code int) bool {
+	return code >= 200 && code <= 599
+}
+
+// Error returns the message of the wrapped error.
+func (e *StatusCodeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *StatusCodeError) Unwrap() error {
+	return e.Err
+}
+
+// applyError attaches the error returned by a test to its result. An error
+// which wraps multiple errors, such as the ones created by errors.Join, is
+// reported in Test.Errors, with the first one as Test.Error. The first code
+// carried by the errors is reported in Test.Code, and the first suggested HTTP
+// status code is kept for the response.
+func applyError(t *Test, err error) {
+	if err == nil {
+		return
+	}
+
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = errs[:0]
+		for _, e := range joined.Unwrap() {
+			if e != nil {
+				errs = append(errs, e)
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return
+	}
+
+	t.Error = Error(errs[0].Error())
+	if len(errs) > 1 {
+		t.Errors = make([]Error, len(errs))
+		for i, e := range errs {
+			t.Errors[i] = Error(e.Error())
+		}
+	}
+
+	for _, e := range errs {
+		var se *StatusError
+		if errors.As(e, &se) && rank(se.Status) > rank(t.Status) {
+			t.Status = se.Status
+		}
+
+		var ce *CodedError
+		if t.Code == "" && errors.As(e, &ce) {
+			t.Code = ce.Code
+		}
+
+		var sce *StatusCodeError
+		if t.statusCode == 0 && errors.As(e, &sce) && validStatusCode(sce.StatusCode) {
+			t.statusCode = sce.StatusCode
+		}
+	}
+}
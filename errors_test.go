@@ -0,0 +1,63 @@
+package hcheck
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyError(t *testing.T) {
+	tcs := []struct {
+		status   Status
+		err      error
+		expected Test
+	}{
+		{Available, nil, Test{Status: Available}},
+		{Degraded, errors.New("slow"), Test{Status: Degraded, Error: "slow"}},
+		{
+			Degraded,
+			errors.Join(WithStatus(errors.New("replica1 unreachable"), Degraded), WithStatus(errors.New("replica2 unreachable"), Unavailable)),
+			Test{
+				Status: Unavailable,
+				Error:  "replica1 unreachable",
+				Errors: []Error{"replica1 unreachable", "replica2 unreachable"},
+			},
+		},
+		{Available, WithStatus(errors.New("degraded"), Degraded), Test{Status: Degraded, Error: "degraded"}},
+		{Unavailable, WithStatus(errors.New("degraded"), Degraded), Test{Status: Unavailable, Error: "degraded"}},
+		{
+			Unavailable,
+			WithCode(errors.New("connection refused"), "DB_CONN_REFUSED"),
+			Test{Status: Unavailable, Error: "connection refused", Code: "DB_CONN_REFUSED"},
+		},
+		{
+			Unavailable,
+			errors.Join(errors.New("timeout"), WithStatus(WithCode(errors.New("refused"), "REFUSED"), Unavailable)),
+			Test{Status: Unavailable, Error: "timeout", Errors: []Error{"timeout", "refused"}, Code: "REFUSED"},
+		},
+		{
+			Unavailable,
+			WithStatusCode(errors.New("rate limited"), 429),
+			Test{Status: Unavailable, Error: "rate limited", statusCode: 429},
+		},
+		{
+			Unavailable,
+			WithStatusCode(errors.New("rate limited"), 0),
+			Test{Status: Unavailable, Error: "rate limited"},
+		},
+		{
+			Unavailable,
+			&StatusCodeError{StatusCode: 1000, Err: errors.New("rate limited")},
+			Test{Status: Unavailable, Error: "rate limited"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tst := Test{Status: tc.status}
+		applyError(&tst, tc.err)
+
+		if !reflect.DeepEqual(tst, tc.expected) {
+			t.Fatalf("Expected test to equal '%+v', got '%+v'", tc.expected, tst)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+//go:build grpc
+
+package hcheck
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCCheck returns a TestFunc which reports the connectivity state of the
+// given gRPC connection. A READY connection is Available, an IDLE or
+// CONNECTING connection is Degraded and any other state is Unavailable. An
+// IDLE connection is asked to connect, so the next run reports its actual
+// state.
+//
+// The gRPC helpers are only built with the `grpc` build tag, so the package
+// doesn't depend on gRPC unless asked for.
+func GRPCCheck(conn *grpc.ClientConn) TestFunc {
+	return func(_ context.Context) (Status, error) {
+		return connState(conn)
+	}
+}
+
+// GRPCHealthCheck returns a TestFunc which, besides the connectivity state,
+// issues the standard gRPC health RPC for the given service against the
+// upstream. An empty service asks for the overall health of the upstream. A
+// SERVING response is Available, any other response is Unavailable. When the
+// upstream doesn't implement the health service, only the connectivity state
+// is reported. The RPC is bound by the deadline of the context.
+func GRPCHealthCheck(conn *grpc.ClientConn, service string) TestFunc {
+	client := healthpb.NewHealthClient(conn)
+
+	return func(ctx context.Context) (Status, error) {
+		if s, err := connState(conn); s == Unavailable {
+			return s, err
+		}
+
+		rsp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if status.Code(err) == codes.Unimplemented {
+			return connState(conn)
+		}
+		if err != nil {
+			return Unavailable, err
+		}
+
+		if rsp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return Unavailable, fmt.Errorf("upstream reported %s", rsp.GetStatus())
+		}
+
+		return Available, nil
+	}
+}
+
+func connState(conn *grpc.ClientConn) (Status, error) {
+	switch state := conn.GetState(); state {
+	case connectivity.Ready:
+		return Available, nil
+	case connectivity.Idle:
+		conn.Connect()
+		return Degraded, fmt.Errorf("connection is %s", state)
+	case connectivity.Connecting:
+		return Degraded, fmt.Errorf("connection is %s", state)
+	default:
+		return Unavailable, fmt.Errorf("connection is %s", state)
+	}
+}
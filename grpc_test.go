@@ -0,0 +1,55 @@
+//go:build grpc
+
+package hcheck
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCHealthCheck(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	hs := health.NewServer()
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	test := GRPCHealthCheck(conn, "payments")
+
+	hs.SetServingStatus("payments", healthpb.HealthCheckResponse_SERVING)
+	if s, err := test(ctx); s != Available {
+		t.Fatalf("Expected status to equal '%s', got '%s' (%v)", Available, s, err)
+	}
+
+	hs.SetServingStatus("payments", healthpb.HealthCheckResponse_NOT_SERVING)
+	if s, _ := test(ctx); s != Unavailable {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Unavailable, s)
+	}
+
+	if s, _ := GRPCCheck(conn)(ctx); s != Available {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Available, s)
+	}
+}
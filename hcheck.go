@@ -1,9 +1,21 @@
 package hcheck
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,15 +27,269 @@ var (
 	Endpoint = "/_hcheck"
 
 	// Timeout represents the duration after which the health check will timeout
-	// and respond with a 503 Service Unavailable.
+	// and respond with a 503 Service Unavailable. It bounds the whole run
+	// rather than each test: the tests which completed in time are reported
+	// with their own status, and the ones still running are reported with the
+	// TimeoutStatus and the time elapsed until the health check gave up on
+	// them. Tests are canceled through their context but not awaited.
 	Timeout = 5 * time.Second
 
+	// StatusHeader represents the response header which carries the overall
+	// status of the health check, so proxies can route on it without reading
+	// the body. A response which doesn't run the tests, such as the 429 Too
+	// Many Requests of MaxInFlight or the 400 Bad Request of an invalid filter,
+	// carries Unknown. It's only absent when the response can't be encoded.
+	StatusHeader = "X-Health-Status"
+
+	// EnableWeight adds the WeightHeader to the response, for load balancers
+	// with weighted routing which keep a degraded instance in rotation, but
+	// shift traffic away from it.
+	EnableWeight = false
+
+	// WeightHeader represents the response header which carries the weight,
+	// from 0 to 100, of the instance. It's 100 while Available, and 0 while
+	// the health check responds with an error. While Degraded, it's the
+	// percentage of tests which are Available, between 1 and 99, so the
+	// instance keeps some traffic.
+	WeightHeader = "X-Health-Weight"
+
+	// MaxBodyBytes represents the maximum size of the response body. When the
+	// encoded response exceeds it, tests are dropped from the response, passing
+	// tests first, and the response is marked as truncated. The overall status
+	// still reflects every test. A value of zero disables the limit.
+	MaxBodyBytes = 0
+
+	// Logger represents the logger used to report notable events, such as
+	// running with checks disabled.
+	Logger = log.New(os.Stderr, "hcheck: ", log.LstdFlags)
+
+	// TimeoutHeader represents the request header through which a caller can
+	// ask for a shorter timeout than Timeout, as a duration string such as
+	// "500ms". Longer timeouts are capped at Timeout and invalid values are
+	// responded to with 400 Bad Request.
+	TimeoutHeader = "X-Health-Timeout"
+
+	// TimeoutStatus represents the status given to tests which didn't complete
+	// before the Timeout. Set it to TimedOut to tell slow tests apart from
+	// failing ones.
+	TimeoutStatus = Unavailable
+
+	// TimeoutSeverity represents the status a TimedOut test counts as when
+	// determining the overall status. It should be Degraded or Unavailable.
+	TimeoutSeverity = Unavailable
+
+	// DisableSummary omits the Summary from the HealthCheck.
+	DisableSummary = false
+
+	// IncludeRuntime adds diagnostic information about the Go runtime to the
+	// HealthCheck. As this exposes internals of the process, the endpoint
+	// should be protected through middleware when it's enabled. Gathering the
+	// information briefly stops the world.
+	IncludeRuntime = false
+
+	// IncludeTestsDuration adds the time spent running the tests, from the
+	// start of the first one until the last result, to the HealthCheck as
+	// tests_duration_ms. The rest of the duration_ms is spent by the handler
+	// itself, which tells a slow dependency from overhead such as aggregating
+	// the results.
+	IncludeTestsDuration = false
+
+	// MaxInFlight represents the maximum number of health checks which may run
+	// at the same time. Requests beyond it are responded to with 429 Too Many
+	// Requests without running any tests, protecting dependencies from probe
+	// storms. A value of zero disables the limit.
+	MaxInFlight = 0
+
+	// ReadyOnce holds back readiness during startup: until the first run of
+	// all the tests of an endpoint with an Available status, such as the tests
+	// of the health endpoint or of a HandlerFor endpoint which weren't narrowed
+	// down by the query parameters, the health check responds with 503 Service
+	// Unavailable, whatever its status. From then on, it responds normally,
+	// even when the status worsens again. The response tells whether the gate
+	// has opened yet in its ready field. The NewLBHandler is held back the
+	// same way, while the LivenessHandler isn't.
+	ReadyOnce = false
+
+	// IncludeStackTraces reports the value and stack trace of a panic in a
+	// test, in its error and details. As this discloses internals of the
+	// process, it should only be enabled in development. Otherwise, a panic is
+	// reported as ErrInternal.
+	IncludeStackTraces = false
+
+	// FailFast cancels the remaining tests as soon as a test reports
+	// Unavailable, which determines the overall status anyway, and responds
+	// right away. The canceled tests are reported as Skipped. Informational
+	// tests don't trigger it.
+	FailFast = false
+
+	// MaxConcurrency represents the number of tests which run at the same
+	// time, across all requests. When set, the tests are run by a pool of that
+	// many workers, which is started on first use and replaced when the value
+	// changes, rather than by a goroutine per test. This bounds the load on
+	// dependencies and the goroutine churn under a high request rate. A value
+	// of zero runs every test in its own goroutine.
+	//
+	// A worker stays busy until its test returns, even after the health check
+	// gave up on it, so a test which ignores the cancellation of its context
+	// and never returns takes a worker for good. Once as many tests hang, every
+	// health check times out.
+	MaxConcurrency = 0
+
+	// MaxTests represents a soft limit on the number of registered tests, as
+	// every test adds to the latency and goroutines of a health check. Each
+	// registration beyond it logs a warning, but still succeeds. A value of
+	// zero disables the limit.
+	MaxTests = 0
+
+	// StartupGrace represents the duration after the start of the process
+	// during which the tests registered with AfterGrace are skipped. The
+	// grace comes first: while it lasts, these tests neither run nor affect
+	// the status, but the ReadyOnce gate doesn't open either, so readiness
+	// waits for their first run after the grace. The other tests, and the
+	// LivenessHandler, are unaffected.
+	StartupGrace time.Duration
+
+	// NoMatchStatusCode represents the HTTP status code of the response when
+	// the tag and test query parameters don't match any test, such as a test
+	// which isn't registered. It defaults to 400 Bad Request; set it to
+	// http.StatusNotFound to report such a test as missing instead. A
+	// malformed pattern, or a code outside of 200-599, is always a 400 Bad
+	// Request.
+	NoMatchStatusCode = http.StatusBadRequest
+
+	// Selector chooses the names of the registered tests to run for a
+	// request, e.g. the dependencies of the tenant a gateway request is for.
+	// Names which aren't registered are ignored, and the tag and test query
+	// parameters further narrow down the selection. It's called before any
+	// test runs, on every request, so it must be fast. When nil, all tests are
+	// run.
+	Selector func(r *http.Request) []string
+
+	// OmitContentType leaves the Content-Type header of the health check
+	// response to an upstream layer, such as a proxy or middleware which sets
+	// its own and conflicts with the one of the serializer. Note that Go's
+	// http server sniffs the content type of a response without one, so the
+	// upstream layer should always set it.
+	OmitContentType = false
+
+	// EncodeErrorHandler writes the response when the health check can't be
+	// serialized, before anything has been written. When nil, the response is
+	// a plain 500 Internal Server Error.
+	EncodeErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+	// AfterCheck is called once for every request which runs the tests, with
+	// the collected results, such as to flush batched metrics or release
+	// resources shared by the tests. It's called in a goroutine of its own once
+	// the response has been written, so a slow hook doesn't delay the
+	// response. It's also called when the tests time out, and with the partial
+	// results when the request is canceled. A request served from the cache
+	// doesn't run the tests, so it isn't called.
+	AfterCheck func(hc HealthCheck)
+
+	// Sequential runs the tests one after another rather than concurrently, for
+	// dependencies which shouldn't be probed all at once. Each test gets an
+	// equal share of the remaining time before the Timeout.
+	Sequential = false
+
 	// ErrTimeout is used to attach to a test when the test took longer than the
 	// time specified in Timeout.
 	ErrTimeout = Error("test took too long")
+
+	// ErrTestRegistered is returned when registering a test under a name which
+	// is already taken.
+	ErrTestRegistered = Error("test already registered")
+
+	// ErrInternal is reported by a test which panicked.
+	ErrInternal = Error("internal error")
+
+	// ErrNilTest is returned when registering a nil test, and reported by a
+	// test which is nil nonetheless.
+	ErrNilTest = Error("test is nil")
+
+	// ErrInvalidStatusOrder is returned when an order given to SetStatusOrder
+	// misses or repeats a status.
+	ErrInvalidStatusOrder = Error("status order has to contain every status once")
+
+	// ErrDraining is reported by the DrainCheck while the service is
+	// draining.
+	ErrDraining = Error("service is draining")
+
+	// ErrUnknownTest is returned by RunTest when no test is registered with
+	// the given name.
+	ErrUnknownTest = Error("no test registered with the given name")
+
+	// ErrStartupGrace is reported by the tests registered with AfterGrace
+	// while the StartupGrace lasts.
+	ErrStartupGrace = Error("skipped during the startup grace")
+
+	// ErrNoTests is returned when a test filter doesn't match any of the
+	// registered tests.
+	ErrNoTests = Error("no tests match the given filter")
+)
+
+var (
+	// registryMu guards healthCheckTests. The map is never modified once
+	// assigned, but replaced by an updated copy, so a run of the tests can keep
+	// using the map it started with while tests are registered.
+	registryMu       sync.RWMutex
+	healthCheckTests = map[string]*registration{}
 )
 
-var healthCheckTests = map[string]TestFunc{}
+// registeredTests returns the registered tests, which must not be modified.
+func registeredTests() map[string]*registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return healthCheckTests
+}
+
+// updateTests replaces the registered tests with a copy modified by the given
+// function, unless it returns an error.
+func updateTests(update func(tests map[string]*registration) error) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	tests := make(map[string]*registration, len(healthCheckTests)+1)
+	for name, reg := range healthCheckTests {
+		tests[name] = reg
+	}
+
+	if err := update(tests); err != nil {
+		return err
+	}
+
+	if MaxTests > 0 && len(tests) > MaxTests && len(tests) > len(healthCheckTests) {
+		Logger.Printf("WARNING: %d tests are registered, exceeding the MaxTests of %d", len(tests), MaxTests)
+	}
+
+	healthCheckTests = tests
+	return nil
+}
+
+// Count returns the number of registered tests.
+func Count() int {
+	return len(registeredTests())
+}
+
+// inFlight counts the health checks currently running.
+var inFlight int32
+
+// runningTests counts the tests currently running.
+var runningTests int64
+
+// InFlightTests returns the number of tests currently running. Tests which
+// ignore the cancellation of their context keep running after the health check
+// gave up on them, so a number which keeps growing points at such a test.
+func InFlightTests() int {
+	return int(atomic.LoadInt64(&runningTests))
+}
+
+// readyGate is set once the gate of ReadyOnce has opened.
+var readyGate int32
+
+// componentsPath represents the path, relative to the health check endpoint,
+// under which the component scoped endpoints are served.
+const componentsPath = "/components/"
 
 // MiddlewareFunc represents a function that acts as middleware.
 type MiddlewareFunc func(http.Handler) http.Handler
@@ -32,6 +298,115 @@ type MiddlewareFunc func(http.Handler) http.Handler
 // check endpoint.
 type TestFunc func(context.Context) (Status, error)
 
+// TestOption represents a function which configures a test when registering
+// it.
+type TestOption func(*registration)
+
+// registration represents a registered test together with its options.
+type registration struct {
+	test          TestFunc
+	description   string
+	component     string
+	tags          []string
+	breaker       *breaker
+	informational bool
+	timeout       time.Duration
+	timeoutStatus Status
+	timeoutErr    error
+	endpoints     []string
+	afterGrace    bool
+}
+
+// inGrace returns whether the test is skipped as the StartupGrace hasn't
+// passed yet.
+func (reg *registration) inGrace() bool {
+	return reg.afterGrace && time.Since(startedAt) < StartupGrace
+}
+
+// timedOut returns the status and error a test is reported with when it
+// times out.
+func (reg *registration) timedOut() (Status, error) {
+	status, err := TimeoutStatus, error(ErrTimeout)
+	if reg.timeoutStatus != "" {
+		status = reg.timeoutStatus
+	}
+	if reg.timeoutErr != nil {
+		err = reg.timeoutErr
+	}
+
+	return status, err
+}
+
+// WithComponent groups the test under the given component. The tests of a
+// component can be run through the component scoped endpoint,
+// /_hcheck/components/{component}.
+func WithComponent(component string) TestOption {
+	return func(reg *registration) {
+		reg.component = component
+	}
+}
+
+// WithTimeout bounds the test to the given timeout, which is shorter than the
+// Timeout of the whole health check. A test exceeding it is cancelled and
+// reported with TimeoutStatus, while the other tests complete normally.
+func WithTimeout(timeout time.Duration) TestOption {
+	return func(reg *registration) {
+		reg.timeout = timeout
+	}
+}
+
+// AfterGrace skips the test until the StartupGrace has passed, for a
+// dependency which isn't required while the service boots, such as one it's
+// still connecting to, but is afterwards. It's reported as Skipped meanwhile.
+// Combined with RegisterFor, and without the LivenessTag, the test only
+// matters for readiness, once the service is up:
+//
+//	hcheck.RegisterFor([]string{"ready"}, "search", searchCheck, hcheck.AfterGrace())
+func AfterGrace() TestOption {
+	return func(reg *registration) {
+		reg.afterGrace = true
+	}
+}
+
+// OnTimeout sets the status and error the test is reported with when it times
+// out, either against its own timeout or the Timeout of the whole health
+// check, such as Degraded with "payment gateway slow" for a check of a
+// non-critical dependency. An empty status or a nil error keeps the
+// TimeoutStatus or ErrTimeout respectively.
+func OnTimeout(status Status, err error) TestOption {
+	return func(reg *registration) {
+		reg.timeoutStatus = status
+		reg.timeoutErr = err
+	}
+}
+
+// WithDescription attaches a human-readable description to the test, such as
+// "PostgreSQL primary connectivity", for dashboards to show instead of its
+// name.
+func WithDescription(description string) TestOption {
+	return func(reg *registration) {
+		reg.description = description
+	}
+}
+
+// Informational marks the test as informational. Informational tests are part
+// of the response, with their own status, but never influence the overall
+// status or the status code.
+func Informational() TestOption {
+	return func(reg *registration) {
+		reg.informational = true
+	}
+}
+
+// WithTags attaches free-form tags to the test. The health endpoint can be
+// narrowed down to the tests carrying any of the tags given in the `tag` query
+// parameters, e.g. `?tag=external&tag=db`.
+func WithTags(tags ...string) TestOption {
+	return func(reg *registration) {
+		reg.tags = append(reg.tags, tags...)
+	}
+}
+
 // Error represents a health check error
 type Error string
 
@@ -52,157 +427,1399 @@ var (
 
 	// Unavailable represents the failure result state
 	Unavailable Status = "unavailable"
+
+	// TimedOut represents the state of a test which didn't complete before the
+	// Timeout.
+	TimedOut Status = "timeout"
+
+	// Skipped represents the state of a test which was canceled by FailFast.
+	// It doesn't count towards the overall status.
+	Skipped Status = "skipped"
+
+	// Unknown represents the state of the service before any health check has
+	// been run.
+	Unknown Status = "unknown"
 )
 
+// SchemaVersion represents the version of the response format, as described
+// by schema.json. It's incremented whenever a field is removed or renamed, or
+// its type or meaning changes. Adding an optional field doesn't change the
+// version, so consumers should ignore fields they don't know about.
+const SchemaVersion = "2"
+
 // HealthCheck represents the overal health check status of the health check
 // request.
 type HealthCheck struct {
-	CheckedAt  time.Time       `json:"checked_at"`
-	DurationMs time.Duration   `json:"duration_ms"`
-	Status     Status          `json:"status"`
-	Tests      map[string]Test `json:"tests"`
+	SchemaVersion   string          `json:"schema_version"`
+	CheckedAt       time.Time       `json:"checked_at"`
+	DurationMs      Duration        `json:"duration_ms"`
+	TestsDurationMs Duration        `json:"tests_duration_ms,omitempty"`
+	Status          Status          `json:"status"`
+	Reason          string          `json:"reason,omitempty"`
+	Ready           *bool           `json:"ready,omitempty"`
+	LastHealthyAt   *time.Time      `json:"last_healthy_at,omitempty"`
+	Tests           map[string]Test `json:"tests"`
+	Summary         *Summary        `json:"summary,omitempty"`
+	Runtime         *RuntimeStats   `json:"runtime,omitempty"`
+	Truncated       bool            `json:"truncated,omitempty"`
+	Stale           bool            `json:"stale,omitempty"`
+}
+
+// RuntimeStats represents diagnostic information about the Go runtime.
+type RuntimeStats struct {
+	Goroutines     int           `json:"goroutines"`
+	GOMAXPROCS     int           `json:"gomaxprocs"`
+	HeapAllocBytes uint64        `json:"heap_alloc_bytes"`
+	NumGC          uint32        `json:"num_gc"`
+	LastGCPauseNs  time.Duration `json:"last_gc_pause_ns"`
+}
+
+// Summary represents a rollup of the tests of a HealthCheck by status.
+type Summary struct {
+	Available        int     `json:"available"`
+	Degraded         int     `json:"degraded"`
+	Unavailable      int     `json:"unavailable"`
+	TimedOut         int     `json:"timeout,omitempty"`
+	Skipped          int     `json:"skipped,omitempty"`
+	PercentAvailable float64 `json:"percent_available"`
 }
 
 // Test represents a single health check test. All the tests combined
-// form the actual HealthCheck.
+// form the actual HealthCheck. A test which wasn't run for the response at
+// hand, but reused from an earlier run, is marked as Cached, with AgeMs as the
+// time since it ran.
 type Test struct {
-	Name       string        `json:"name"`
-	DurationMs time.Duration `json:"duration_ms"`
-	Status     Status        `json:"status"`
-	Error      Error         `json:"error,omitempty"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Tags          []string               `json:"tags,omitempty"`
+	DurationMs    Duration               `json:"duration_ms"`
+	Status        Status                 `json:"status"`
+	Error         Error                  `json:"error,omitempty"`
+	Errors        []Error                `json:"errors,omitempty"`
+	Code          string                 `json:"code,omitempty"`
+	Breaker       string                 `json:"breaker,omitempty"`
+	Informational bool                   `json:"informational,omitempty"`
+	Cached        bool                   `json:"cached,omitempty"`
+	AgeMs         Duration               `json:"age_ms,omitempty"`
+	LastHealthyAt *time.Time             `json:"last_healthy_at,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+
+	// statusCode represents the HTTP status code suggested by the test
+	statusCode int
 }
 
 // NewHandler wraps the given http handler with a /_hcheck endpoint.
+//
+// By default the endpoint runs every registered test. The tests can be narrowed
+// down with one or more `test` query parameters, each of which is matched
+// against the registered test names. A parameter is either an exact name or a
+// glob pattern as understood by path.Match, so `?test=db.*` selects all tests
+// prefixed with `db.` and `?test=db.replica?` selects `db.replica1` but not
+// `db.primary`. When no registered test matches, the endpoint responds with
+// the NoMatchStatusCode, 400 Bad Request by default.
+//
+// Tests which are registered with a component are also served on
+// /_hcheck/components/{component}, which only runs the tests of that
+// component. Unknown components respond with 404 Not Found.
 func NewHandler(dh http.Handler) http.Handler {
 	return NewHandlerWithMiddleware(dh)
 }
 
 // NewHandlerWithMiddleware wraps the given handler with a new health endpoint.
-// This health endpoint will be wrapped in the provided middleware.
+// This health endpoint will be wrapped in the provided middleware, which runs
+// in the order it's given: the first middleware is the outermost one and sees
+// the request first, so auth, logging and CORS middleware can be listed the
+// way they should execute. When the given handler is nil, there's no
+// passthrough and the returned handler only serves the health endpoints,
+// responding with 404 Not Found to anything else.
 func NewHandlerWithMiddleware(dh http.Handler, mw ...MiddlewareFunc) http.Handler {
-	var handler http.Handler
 	h := http.NewServeMux()
 
-	handler = http.HandlerFunc(healthHandler)
-	for _, mwh := range mw {
-		handler = mwh(handler)
+	Register(h, mw...)
+	if dh != nil {
+		h.Handle("/", dh)
 	}
 
-	h.Handle(Prefix+Endpoint, handler)
-	h.Handle("/", dh)
+	return h
+}
+
+// Register adds the health endpoint, and its component scoped endpoints, to
+// the given mux. Unlike NewHandlerWithMiddleware, it leaves all other routes
+// to the mux. The provided middleware only wraps the health endpoints.
+func Register(mux *http.ServeMux, mw ...MiddlewareFunc) {
+	mux.Handle(Prefix+Endpoint, withMiddleware(http.HandlerFunc(healthHandler), mw))
+	mux.Handle(Prefix+Endpoint+componentsPath, withMiddleware(http.HandlerFunc(componentHandler), mw))
+	if EnableMetrics {
+		mux.Handle(Prefix+Endpoint+metricsPath, withMiddleware(http.HandlerFunc(metricsHandler), mw))
+	}
+	if EnableWatch {
+		mux.Handle(Prefix+Endpoint+watchPath, withMiddleware(http.HandlerFunc(watchHandler), mw))
+	}
+	if AuthorizeRun != nil {
+		mux.Handle(Prefix+Endpoint+runPath, withMiddleware(http.HandlerFunc(runHandler), mw))
+	}
+}
+
+// NewNoopHandler wraps the given http handler with a health endpoint which
+// always responds with 200 OK and an Available status, without running any of
+// the registered tests. It's meant for local development, where the real
+// dependencies aren't around, and logs a warning so it doesn't go unnoticed
+// when it ends up in production. As with NewHandler, a nil handler disables
+// the passthrough.
+func NewNoopHandler(dh http.Handler) http.Handler {
+	Logger.Printf("WARNING: health checks are disabled, %s always reports %s", Prefix+Endpoint, Available)
+
+	h := http.NewServeMux()
+	h.HandleFunc(Prefix+Endpoint, noopHandler)
+	if dh != nil {
+		h.Handle("/", dh)
+	}
 
 	return h
 }
 
+func noopHandler(w http.ResponseWriter, r *http.Request) {
+	handleResponse(w, r, HealthCheck{
+		SchemaVersion: SchemaVersion,
+		CheckedAt:     time.Now(),
+		Tests:         map[string]Test{},
+		Status:        Available,
+	})
+}
+
+// Handler returns the health endpoint, and its component scoped endpoints,
+// wrapped in the provided middleware. It's meant to be mounted on a router at
+// Prefix+Endpoint, including the paths below it, and responds with 404 Not
+// Found to any other path.
+func Handler(mw ...MiddlewareFunc) http.Handler {
+	return withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == Prefix+Endpoint:
+			healthHandler(w, r)
+		case strings.HasPrefix(r.URL.Path, Prefix+Endpoint+componentsPath):
+			componentHandler(w, r)
+		case EnableMetrics && r.URL.Path == Prefix+Endpoint+metricsPath:
+			metricsHandler(w, r)
+		case EnableWatch && r.URL.Path == Prefix+Endpoint+watchPath:
+			watchHandler(w, r)
+		case AuthorizeRun != nil && strings.HasPrefix(r.URL.Path, Prefix+Endpoint+runPath):
+			runHandler(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}), mw)
+}
+
+// withMiddleware wraps the handler in the given middleware, with the first
+// middleware as the outermost one, so it's the first to run.
+func withMiddleware(handler http.Handler, mw []MiddlewareFunc) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+
+	return handler
+}
+
 // RegisterTest adds a test to the HealthCheck handler. If a tests with the
-// given name is already registered, this will panic.
-func RegisterTest(name string, test TestFunc) {
-	if _, ok := healthCheckTests[name]; ok {
+// given name is already registered, or the test is nil, this will panic.
+func RegisterTest(name string, test TestFunc, opts ...TestOption) {
+	switch TryRegisterTest(name, test, opts...) {
+	case ErrTestRegistered:
 		panic("Test already registered")
+	case ErrNilTest:
+		panic("Test " + name + " is nil")
+	}
+}
+
+// TryRegisterTest adds a test to the HealthCheck handler like RegisterTest,
+// but returns ErrTestRegistered instead of panicking when a test with the given
+// name is already registered, and ErrNilTest when the test is nil.
+func TryRegisterTest(name string, test TestFunc, opts ...TestOption) error {
+	if test == nil {
+		return ErrNilTest
+	}
+
+	reg := &registration{test: test}
+	for _, opt := range opts {
+		opt(reg)
+	}
+
+	return updateTests(func(tests map[string]*registration) error {
+		if _, ok := tests[name]; ok {
+			return ErrTestRegistered
+		}
+
+		tests[name] = reg
+		return nil
+	})
+}
+
+// RegisterOrReplace adds a test to the HealthCheck handler like RegisterTest,
+// but replaces the test already registered with the given name rather than
+// panicking, e.g. to swap out a check when its configuration is reloaded. It
+// returns whether a test was replaced. Health checks already running keep
+// running the test they started with. It panics when the test is nil.
+func RegisterOrReplace(name string, test TestFunc, opts ...TestOption) bool {
+	if test == nil {
+		panic("Test " + name + " is nil")
 	}
 
-	healthCheckTests[name] = test
+	reg := &registration{test: test}
+	for _, opt := range opts {
+		opt(reg)
+	}
+
+	var replaced bool
+	updateTests(func(tests map[string]*registration) error {
+		_, replaced = tests[name]
+		tests[name] = reg
+		return nil
+	})
+
+	return replaced
+}
+
+// RegisterFor adds a test which only runs on the given endpoints, as served by
+// HandlerFor, such as a dependency which matters for readiness but not for
+// liveness. Tests added through RegisterTest run on every endpoint. The health
+// endpoint itself keeps running every registered test, so it gives the full
+// picture. Like RegisterTest, it panics when the name is taken or the test is
+// nil.
+func RegisterFor(endpoints []string, name string, test TestFunc, opts ...TestOption) {
+	// capping the capacity makes append copy the options rather than write
+	// into the spare capacity of the caller's slice
+	opts = append(opts[:len(opts):len(opts)], func(reg *registration) {
+		reg.endpoints = endpoints
+	})
+	RegisterTest(name, test, opts...)
+}
+
+// HandlerFor returns a handler for the given endpoint, wrapped in the provided
+// middleware, meant to be mounted on a path of its own such as /ready. It runs
+// the tests added through RegisterTest, and the ones added for the endpoint
+// through RegisterFor. The tests can be narrowed down with the query
+// parameters understood by NewHandler.
+func HandlerFor(endpoint string, mw ...MiddlewareFunc) http.Handler {
+	return withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handleOptions(w, r) {
+			return
+		}
+
+		tests := map[string]*registration{}
+		for name, reg := range registeredTests() {
+			if reg.runsOn(endpoint) {
+				tests[name] = reg
+			}
+		}
+
+		scope := tests
+		tests, err := selectTests(tests, filterQuery(r))
+		if err != nil {
+			errorResponse(w, err.Error(), filterStatusCode(err))
+			return
+		}
+
+		runTestsWith(w, r, tests, runOptions{scope: scope})
+	}), mw)
+}
+
+// LivenessTag represents the tag of the tests which are run by the
+// LivenessHandler.
+const LivenessTag = "liveness"
+
+// LivenessHandler returns a handler for liveness probes, wrapped in the
+// provided middleware. It only runs the tests tagged with LivenessTag, which
+// should check the process itself, such as a deadlocked worker, and responds
+// with 200 OK when there are none. It never runs dependency checks: a liveness
+// probe failing because a database is down makes Kubernetes restart a pod
+// which is perfectly alive.
+//
+// The recommended split is to point the liveness probe at this handler and the
+// readiness probe at the health endpoint, or at a HandlerFor endpoint, so a
+// pod with failing dependencies is taken out of rotation rather than
+// restarted. For the same reason, it isn't held back by ReadyOnce and isn't
+// shed by MaxInFlight, so a pod which is still warming up is left alone.
+func LivenessHandler(mw ...MiddlewareFunc) http.Handler {
+	return withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handleOptions(w, r) {
+			return
+		}
+
+		tests := map[string]*registration{}
+		for name, reg := range registeredTests() {
+			for _, tag := range reg.tags {
+				if tag == LivenessTag {
+					tests[name] = reg
+					break
+				}
+			}
+		}
+
+		runTestsWith(w, r, tests, runOptions{liveness: true})
+	}), mw)
+}
+
+// runsOn returns whether the test runs on the given endpoint.
+func (reg *registration) runsOn(endpoint string) bool {
+	if len(reg.endpoints) == 0 {
+		return true
+	}
+
+	for _, e := range reg.endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RegisterAll adds a batch of tests to the HealthCheck handler, such as a
+// fixed set of dependency checks built from configuration. The registration is
+// atomic: when any of the names is already registered, none of the tests are
+// and ErrTestRegistered is returned. Likewise, ErrNilTest is returned when any
+// of the tests is nil.
+func RegisterAll(tests map[string]TestFunc) error {
+	for _, test := range tests {
+		if test == nil {
+			return ErrNilTest
+		}
+	}
+
+	return updateTests(func(registered map[string]*registration) error {
+		for name := range tests {
+			if _, ok := registered[name]; ok {
+				return ErrTestRegistered
+			}
+		}
+
+		for name, test := range tests {
+			registered[name] = &registration{test: test}
+		}
+		return nil
+	})
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	if handleOptions(w, r) {
+		return
+	}
+
+	tests, err := selected(r)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scope := tests
+	tests, err = selectTests(tests, filterQuery(r))
+	if err != nil {
+		errorResponse(w, err.Error(), filterStatusCode(err))
+		return
+	}
+
+	runTestsWith(w, r, tests, runOptions{scope: scope})
+}
+
+// selected returns the tests the Selector chooses for the request, or all
+// registered tests without a Selector. It returns ErrNoTests when the Selector
+// doesn't choose any registered test.
+func selected(r *http.Request) (map[string]*registration, error) {
+	if Selector == nil {
+		return registeredTests(), nil
+	}
+
+	tests := map[string]*registration{}
+	registered := registeredTests()
+	for _, name := range Selector(r) {
+		if reg, ok := registered[name]; ok {
+			tests[name] = reg
+		}
+	}
+
+	if len(tests) == 0 {
+		return nil, ErrNoTests
+	}
+
+	return tests, nil
+}
+
+func componentHandler(w http.ResponseWriter, r *http.Request) {
+	if handleOptions(w, r) {
+		return
+	}
+
+	// a component which responds differently from an unknown one would tell
+	// a redacted caller which components exist
+	if isRedacted(r) {
+		errorResponse(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	component := strings.TrimPrefix(r.URL.Path, Prefix+Endpoint+componentsPath)
+
+	tests := map[string]*registration{}
+	for name, reg := range registeredTests() {
+		if reg.component != "" && reg.component == component {
+			tests[name] = reg
+		}
+	}
+
+	if len(tests) == 0 {
+		errorResponse(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	tests, err := selectTests(tests, filterQuery(r))
+	if err != nil {
+		errorResponse(w, err.Error(), filterStatusCode(err))
+		return
+	}
+
+	runTests(w, r, tests)
+}
+
+// handleOptions responds to OPTIONS requests with the supported methods,
+// without running any tests. It reports whether the request was handled.
+func handleOptions(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodOptions {
+		return false
+	}
+
+	w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// selectTests returns the tests matching the `tag` and `test` query
+// parameters. A test matches when it has any of the given tags and its name
+// matches any of the given patterns. Without parameters, all given tests are
+// returned.
+func selectTests(all map[string]*registration, query url.Values) (map[string]*registration, error) {
+	tags, patterns := query["tag"], query["test"]
+	if len(tags) == 0 && len(patterns) == 0 {
+		return all, nil
+	}
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, Error(fmt.Sprintf("invalid test pattern %q", pattern))
+		}
+	}
+
+	tests := map[string]*registration{}
+	for name, reg := range all {
+		if len(tags) > 0 && !hasAnyTag(reg.tags, tags) {
+			continue
+		}
+
+		if len(patterns) > 0 && !matchesAnyPattern(name, patterns) {
+			continue
+		}
+
+		tests[name] = reg
+	}
+
+	if len(tests) == 0 {
+		return nil, ErrNoTests
+	}
+
+	return tests, nil
+}
+
+// errorResponse responds like http.Error to a request which doesn't run the
+// tests, so their status is Unknown.
+func errorResponse(w http.ResponseWriter, msg string, code int) {
+	w.Header().Set(StatusHeader, string(Unknown))
+	http.Error(w, msg, code)
+}
+
+// filterQuery returns the query parameters which narrow down the tests of the
+// request. A redacted request runs all of its tests, as the status code of a
+// filtered request would tell which tests exist and how they're doing.
+func filterQuery(r *http.Request) url.Values {
+	if isRedacted(r) {
+		return nil
+	}
+
+	return r.URL.Query()
+}
+
+// filterStatusCode returns the HTTP status code of a response to a request
+// whose test filter failed with the given error.
+func filterStatusCode(err error) int {
+	if err == ErrNoTests && validStatusCode(NoMatchStatusCode) {
+		return NoMatchStatusCode
+	}
+
+	return http.StatusBadRequest
+}
+
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if tag == w {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchesAnyPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runOptions represents how a handler runs its tests.
+type runOptions struct {
+	// liveness exempts the run from the ReadyOnce gate and MaxInFlight
+	liveness bool
+
+	// scope represents the tests of the endpoint before the query parameters
+	// narrowed them down. A run of all of them can open the ReadyOnce gate.
+	// When nil, it's every registered test.
+	scope map[string]*registration
+}
+
+func runTests(w http.ResponseWriter, r *http.Request, tests map[string]*registration) {
+	runTestsWith(w, r, tests, runOptions{})
+}
+
+func runTestsWith(w http.ResponseWriter, r *http.Request, tests map[string]*registration, opts runOptions) {
+	if !opts.liveness {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		if MaxInFlight > 0 && int(n) > MaxInFlight {
+			w.Header().Set("Retry-After", "1")
+			errorResponse(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if hc, ok := fromCache(tests); ok {
+		if opts.liveness {
+			hc.Ready = nil
+		}
+		handleResponse(w, r, hc)
+		return
+	}
+
+	timeout, err := requestTimeout(r)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, err := withChain(r.Context(), r)
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hc, err := checkWith(ctx, tests, timeout, opts)
+	if afterCheck := AfterCheck; afterCheck != nil {
+		defer func() {
+			go afterCheck(hc)
+		}()
+	}
+	if err != nil {
+		// the client went away, there's nobody left to respond to
+		return
+	}
+
+	handleResponse(w, r, hc)
+
+	// only a run of every registered test reflects the overall status
+	if len(tests) == len(registeredTests()) {
+		trackStatus(hc)
+	}
+}
+
+// requestTimeout returns the timeout for the request, which is the Timeout
+// unless the request asks for a shorter one through the TimeoutHeader.
+func requestTimeout(r *http.Request) (time.Duration, error) {
+	header := r.Header.Get(TimeoutHeader)
+	if header == "" {
+		return Timeout, nil
+	}
+
+	timeout, err := time.ParseDuration(header)
+	if err != nil || timeout <= 0 {
+		return 0, Error(fmt.Sprintf("invalid %s header %q", TimeoutHeader, header))
+	}
+
+	if timeout < Timeout {
+		return timeout, nil
+	}
+
+	return Timeout, nil
+}
+
+// check runs the given tests and aggregates their results into a HealthCheck.
+// Tests which didn't complete within the timeout, or before the deadline of
+// the given context when that's sooner, are marked as timed out. It returns an
+// error when the given context is canceled before all tests completed.
+func check(parent context.Context, tests map[string]*registration, timeout time.Duration) (HealthCheck, error) {
+	return checkWith(parent, tests, timeout, runOptions{})
+}
+
+// checkWith runs the given tests like check, according to the given options.
+func checkWith(parent context.Context, tests map[string]*registration, timeout time.Duration, opts runOptions) (HealthCheck, error) {
 	start := time.Now()
 
 	hc := HealthCheck{
-		CheckedAt: time.Now(),
-		Tests:     map[string]Test{},
-		Status:    Available,
+		SchemaVersion: SchemaVersion,
+		CheckedAt:     time.Now(),
+		Tests:         map[string]Test{},
+		Status:        Available,
 	}
 
-	ctx, cancel := context.WithDeadline(r.Context(), time.Now().Add(Timeout))
+	ctx, cancel := context.WithDeadline(parent, time.Now().Add(timeout))
 	defer cancel()
 
-	rspChan := make(chan Test, len(healthCheckTests))
+	rspChan := make(chan Test, len(tests))
 	statuses := []Status{}
-	for name, test := range healthCheckTests {
-		go runTest(ctx, name, test, rspChan)
+	fanOut := time.Now()
+	switch {
+	case Sequential:
+		go runSequential(ctx, tests, rspChan)
+	case MaxConcurrency > 0:
+		p := acquirePool(MaxConcurrency)
+	submit:
+		for name, reg := range tests {
+			select {
+			case p.jobs <- job{ctx: ctx, name: name, reg: reg, rspChan: rspChan}:
+			case <-ctx.Done():
+				// the tests which weren't submitted are reported as timed out
+				break submit
+			}
+		}
+		p.release()
+	default:
+		for name, reg := range tests {
+			go runTest(ctx, name, reg, rspChan)
+		}
 	}
 
-	for i := 0; i < len(healthCheckTests); i++ {
+loop:
+	for i := 0; i < len(tests); i++ {
 		select {
 		case rsp := <-rspChan:
-			statuses = append(statuses, rsp.Status)
+			if !rsp.Informational {
+				statuses = append(statuses, rsp.Status)
+			}
 			hc.Tests[rsp.Name] = rsp
+
+			if FailFast && rsp.Status == Unavailable && !rsp.Informational {
+				cancel()
+				skipTests(hc.Tests, tests, rsp.Name)
+				break loop
+			}
 		case <-ctx.Done():
-			w.WriteHeader(http.StatusServiceUnavailable)
-			hc.Status = Unavailable
+			// a canceled request went away, rather than its tests taking too
+			// long, so there's nobody to report the timeout to
+			if ctx.Err() != context.DeadlineExceeded {
+				return hc, ctx.Err()
+			}
 
-			for name := range healthCheckTests {
+			for name, reg := range tests {
 				if _, ok := hc.Tests[name]; !ok {
-					hc.Tests[name] = Test{
-						Name:       name,
-						Status:     Unavailable,
-						Error:      ErrTimeout,
-						DurationMs: Timeout / time.Millisecond,
+					t := timedOutTest(name, reg, time.Since(start))
+					if !reg.informational {
+						statuses = append(statuses, t.Status)
 					}
+					hc.Tests[name] = t
 				}
 			}
 
-			handleResponse(w, hc, start)
-			return
+			break loop
 		}
 	}
+	// the request may go away while the last test reports its result
+	if parent.Err() == context.Canceled {
+		return hc, parent.Err()
+	}
+	if IncludeTestsDuration {
+		hc.TestsDurationMs = Duration(time.Since(fanOut))
+	}
 
 	hc.Status = getOverallStatus(statuses)
+	if Aggregate != nil {
+		hc.Status = Aggregate(decidingTests(hc.Tests))
+	}
+	hc.Reason = reason(hc)
+	full := len(tests) == len(registeredTests())
+	recordHealthy(&hc, full)
+	if ReadyOnce && !opts.liveness {
+		complete := full
+		if opts.scope != nil {
+			complete = len(tests) == len(opts.scope)
+		}
+		if hc.Status == Available && complete && !inGrace(tests) {
+			atomic.StoreInt32(&readyGate, 1)
+		}
+		ready := atomic.LoadInt32(&readyGate) == 1
+		hc.Ready = &ready
+	}
+	if !DisableSummary {
+		hc.Summary = summarize(hc.Tests)
+	}
+	if IncludeRuntime {
+		hc.Runtime = runtimeStats()
+	}
+	hc.DurationMs = Duration(time.Since(start))
+
+	return hc, nil
+}
+
+func runtimeStats() *RuntimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return &RuntimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		HeapAllocBytes: m.HeapAlloc,
+		NumGC:          m.NumGC,
+		LastGCPauseNs:  time.Duration(m.PauseNs[(m.NumGC+255)%256]),
+	}
+}
+
+func summarize(tests map[string]Test) *Summary {
+	s := &Summary{PercentAvailable: 100}
+	for _, t := range tests {
+		switch t.Status {
+		case Available:
+			s.Available++
+		case Degraded:
+			s.Degraded++
+		case Unavailable:
+			s.Unavailable++
+		case TimedOut:
+			s.TimedOut++
+		case Skipped:
+			s.Skipped++
+		}
+	}
+
+	if len(tests) > 0 {
+		s.PercentAvailable = float64(s.Available) / float64(len(tests)) * 100
+	}
+
+	return s
+}
+
+func handleResponse(w http.ResponseWriter, r *http.Request, hc HealthCheck) {
+	serializer := negotiateSerializer(r)
+	if !OmitContentType {
+		w.Header().Set("Content-Type", serializer.ContentType())
+	}
+	w.Header().Set(StatusHeader, string(hc.Status))
+	if EnableWeight {
+		w.Header().Set(WeightHeader, strconv.Itoa(weight(hc)))
+	}
+
+	// the status code is derived from the full result, only the body is
+	// redacted
+	body := hc
+	if isRedacted(r) {
+		body = redact(hc)
+	} else if hc.Status == Degraded {
+		w.Header().Set("Warning", degradedWarning(hc))
+	}
+	if hc.Stale {
+		w.Header().Add("Warning", `110 - "Response is Stale"`)
+	}
+
+	// the body is encoded up front, so an encoding error still results in a
+	// clean response
+	var b []byte
+	var err error
+	if MaxBodyBytes > 0 {
+		b, err = truncateResponse(serializer, body, MaxBodyBytes)
+	} else {
+		b, err = serialize(serializer, body)
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		w.Header().Del(StatusHeader)
+		w.Header().Del("Warning")
+		w.Header().Del(WeightHeader)
+		if EncodeErrorHandler != nil {
+			EncodeErrorHandler(w, r, err)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeStatus(w, hc)
+	w.Write(b)
+}
+
+// suggestedStatusCode returns the HTTP status code suggested by the failing
+// test, with the overall status, whose name sorts first. It returns zero when
+// there's no such suggestion.
+func suggestedStatusCode(hc HealthCheck) int {
+	if statusLevel(hc.Status) == 0 {
+		return 0
+	}
+
+	var deciding string
+	for name, test := range hc.Tests {
+		if test.statusCode == 0 || test.Informational || test.Status != hc.Status {
+			continue
+		}
+		if deciding == "" || name < deciding {
+			deciding = name
+		}
+	}
+	if deciding == "" {
+		return 0
+	}
+
+	return hc.Tests[deciding].statusCode
+}
+
+// customStatus represents a status registered through RegisterStatus.
+type customStatus struct {
+	code     int
+	severity int
+}
+
+var customStatuses = map[Status]customStatus{}
+
+// RegisterStatus registers a status beyond the built-in ones, such as
+// "maintenance" or "warming", which tests can return. The health check responds
+// with the given HTTP status code when it's the overall status. The severity
+// orders it among the other statuses when determining the overall status,
+// where the worst wins: Available has a severity of 0, Degraded of 1 and
+// Unavailable of 2. Custom statuses should have a severity distinct from the
+// built-in ones, or ties are broken by the order tests finish in.
+//
+// It panics when registering a built-in status or a status twice, or when the
+// code is outside of 200-599.
+func RegisterStatus(status Status, code int, severity int) {
+	switch status {
+	case Available, Degraded, Unavailable, TimedOut, Skipped, Unknown:
+		panic("Status is built-in")
+	}
+	if !validStatusCode(code) {
+		panic("Status code " + strconv.Itoa(code) + " is invalid")
+	}
+	if _, ok := customStatuses[status]; ok {
+		panic("Status already registered")
+	}
+
+	customStatuses[status] = customStatus{code: code, severity: severity}
+}
+
+// reason returns a one-line explanation of an overall status other than
+// Available, such as "db: connection refused", listing the tests with the
+// worst status.
+func reason(hc HealthCheck) string {
+	if statusLevel(hc.Status) == 0 {
+		return ""
+	}
+
+	worst := rank(hc.Status)
+	var names []string
+	for name, test := range hc.Tests {
+		if !test.Informational && rank(test.Status) == worst {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	reasons := make([]string, len(names))
+	for i, name := range names {
+		msg := string(hc.Tests[name].Error)
+		if msg == "" {
+			msg = string(hc.Tests[name].Status)
+		}
+		reasons[i] = name + ": " + msg
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+// degradedWarning formats an RFC 7234 Warning header value listing the
+// degraded tests, so a degraded service can stay in rotation with a 200 while
+// still signalling the degradation out-of-band.
+func degradedWarning(hc HealthCheck) string {
+	var names []string
+	for name, test := range hc.Tests {
+		if test.Status == Degraded && !test.Informational {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("199 - %q", "degraded: "+strings.Join(names, ", "))
+}
+
+// writeStatus writes the HTTP status code for the health check. A code
+// suggested through WithStatusCode by a test deciding the overall status
+// overrides the default mapping.
+func writeStatus(w http.ResponseWriter, hc HealthCheck) {
+	if hc.Ready != nil && !*hc.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if code := suggestedStatusCode(hc); code != 0 {
+		w.WriteHeader(code)
+		return
+	}
+
+	if cs, ok := customStatuses[hc.Status]; ok {
+		w.WriteHeader(cs.code)
+		return
+	}
+
 	switch hc.Status {
 	case Unavailable:
 		w.WriteHeader(http.StatusServiceUnavailable)
 	default:
 		w.WriteHeader(http.StatusOK)
 	}
+}
 
-	handleResponse(w, hc, start)
+// weight returns the weight of the instance for the WeightHeader.
+func weight(hc HealthCheck) int {
+	if (hc.Ready != nil && !*hc.Ready) || statusLevel(hc.Status) == 2 {
+		return 0
+	}
+	if statusLevel(hc.Status) == 0 {
+		return 100
+	}
+
+	tests := decidingTests(hc.Tests)
+	available := 0
+	for _, t := range tests {
+		if t.Status == Available {
+			available++
+		}
+	}
+
+	w := 1
+	if len(tests) > 0 {
+		w = available * 100 / len(tests)
+	}
+	if w < 1 {
+		return 1
+	}
+	if w > 99 {
+		return 99
+	}
+
+	return w
+}
+
+// truncateResponse encodes the health check, dropping as few tests as needed
+// to fit within max bytes. Tests are kept in order of severity so failing
+// tests are the last to be dropped.
+func truncateResponse(s Serializer, hc HealthCheck, max int) ([]byte, error) {
+	body, err := serialize(s, hc)
+	if err != nil || len(body) <= max {
+		return body, err
+	}
+
+	names := make([]string, 0, len(hc.Tests))
+	for name := range hc.Tests {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		si, sj := rank(hc.Tests[names[i]].Status), rank(hc.Tests[names[j]].Status)
+		if si != sj {
+			return si > sj
+		}
+		return names[i] < names[j]
+	})
+
+	all := hc.Tests
+	hc.Truncated = true
+	encode := func(n int) ([]byte, error) {
+		hc.Tests = make(map[string]Test, n)
+		for _, name := range names[:n] {
+			hc.Tests[name] = all[name]
+		}
+		return serialize(s, hc)
+	}
+
+	// find the largest amount of tests which still fits the limit
+	n := sort.Search(len(names)+1, func(n int) bool {
+		b, err := encode(n)
+		return err != nil || len(b) > max
+	}) - 1
+	if n < 0 {
+		n = 0
+	}
+
+	return encode(n)
+}
+
+func serialize(s Serializer, hc HealthCheck) ([]byte, error) {
+	var buf bytes.Buffer
+	err := s.Serialize(&buf, hc)
+	return buf.Bytes(), err
+}
+
+type testNameKey struct{}
+
+// TestNameFromContext returns the name the running test was registered with,
+// which allows a single TestFunc registered under several names to tell those
+// registrations apart.
+func TestNameFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(testNameKey{}).(string)
+	return name, ok
+}
+
+// skipTests marks the tests which haven't completed as skipped, because the
+// given test failed.
+func skipTests(results map[string]Test, tests map[string]*registration, failed string) {
+	for name, reg := range tests {
+		if _, ok := results[name]; !ok {
+			results[name] = Test{
+				Name:          name,
+				Description:   reg.description,
+				Component:     reg.component,
+				Tags:          reg.tags,
+				Status:        Skipped,
+				Error:         Error("skipped as " + failed + " is unavailable"),
+				Informational: reg.informational,
+			}
+		}
+	}
+}
+
+// timedOutTest returns the result of a test which didn't complete within the
+// given duration.
+func timedOutTest(name string, reg *registration, d time.Duration) Test {
+	t := Test{
+		Name:          name,
+		Description:   reg.description,
+		Component:     reg.component,
+		Tags:          reg.tags,
+		DurationMs:    Duration(d),
+		Informational: reg.informational,
+	}
+	status, err := reg.timedOut()
+	t.Status = status
+	applyError(&t, err)
+
+	return t
+}
+
+// runSequential runs the tests one after another, in the order of their
+// names. Each test gets an equal share of the time remaining until the
+// deadline of the context, split among the tests which haven't run yet, so a
+// slow test early on can't starve the ones after it. A test which exceeds its
+// share is reported as timed out, and the time it leaves unused is passed on
+// to the next tests.
+func runSequential(ctx context.Context, tests map[string]*registration, rspChan chan Test) {
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	deadline, _ := ctx.Deadline()
+	for i, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+
+		share := time.Until(deadline) / time.Duration(len(names)-i)
+		tctx, cancel := context.WithTimeout(ctx, share)
+
+		testChan := make(chan Test, 1)
+		go runTest(tctx, name, tests[name], testChan)
+
+		select {
+		case rsp := <-testChan:
+			rspChan <- rsp
+		case <-tctx.Done():
+			if ctx.Err() != nil {
+				cancel()
+				return
+			}
+			rspChan <- timedOutTest(name, tests[name], share)
+		}
+		cancel()
+	}
 }
 
-func handleResponse(w http.ResponseWriter, hc HealthCheck, start time.Time) {
-	hc.DurationMs = time.Since(start) / time.Millisecond
-	if err := json.NewEncoder(w).Encode(hc); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+// callTest calls the test, recovering from a panic in it by reporting it
+// Unavailable. Unless IncludeStackTraces is set, the error doesn't reveal
+// anything about the panic.
+func callTest(ctx context.Context, test TestFunc) (status Status, err error) {
+	atomic.AddInt64(&runningTests, 1)
+	defer atomic.AddInt64(&runningTests, -1)
+
+	defer func() {
+		if r := recover(); r != nil {
+			status, err = Unavailable, ErrInternal
+			if IncludeStackTraces {
+				err = fmt.Errorf("panic: %v", r)
+				SetDetail(ctx, "stack", string(debug.Stack()))
+			}
+		}
+	}()
+
+	return test(ctx)
+}
+
+// callTestWithTimeout calls the test like callTest, but gives up on it once
+// its timeout passes, cancelling its context and reporting it as timed out.
+func callTestWithTimeout(ctx context.Context, reg *registration) (Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, reg.timeout)
+	defer cancel()
+
+	type result struct {
+		status Status
+		err    error
+	}
+	rspChan := make(chan result, 1)
+	go func() {
+		status, err := callTest(ctx, reg.test)
+		rspChan <- result{status, err}
+	}()
+
+	select {
+	case rsp := <-rspChan:
+		// a test which gave up as it ran out of time still timed out
+		if ctx.Err() == context.DeadlineExceeded {
+			return reg.timedOut()
+		}
+		return rsp.status, rsp.err
+	case <-ctx.Done():
+		return reg.timedOut()
 	}
 }
 
-func runTest(ctx context.Context, name string, test TestFunc, rspChan chan Test) {
+func runTest(ctx context.Context, name string, reg *registration, rspChan chan Test) {
 	hct := Test{
-		Name:   name,
-		Status: Available,
+		Name:          name,
+		Description:   reg.description,
+		Component:     reg.component,
+		Tags:          reg.tags,
+		Status:        Available,
+		Informational: reg.informational,
+	}
+
+	if reg.inGrace() {
+		hct.Status = Skipped
+		hct.Error = ErrStartupGrace
+		rspChan <- hct
+		return
+	}
+
+	if reg.test == nil {
+		hct.Status = Unavailable
+		hct.Error = ErrNilTest
+		rspChan <- hct
+		return
+	}
+
+	// the breaker is consulted last, so an allowed trial is always recorded
+	if reg.breaker != nil {
+		ok, state := reg.breaker.allow()
+		if !ok {
+			hct.Status = Unavailable
+			hct.Error = ErrBreakerOpen
+			hct.Breaker = state
+			rspChan <- hct
+			return
+		}
 	}
 
+	d := &details{}
+	ctx = context.WithValue(ctx, detailsKey{}, d)
+	ctx = context.WithValue(ctx, testNameKey{}, name)
+
 	tStart := time.Now()
-	testStatus, err := test(ctx)
-	if err != nil {
-		hct.Error = Error(err.Error())
+	var testStatus Status
+	var err error
+	if reg.timeout > 0 {
+		testStatus, err = callTestWithTimeout(ctx, reg)
+	} else {
+		testStatus, err = callTest(ctx, reg.test)
 	}
+	elapsed := time.Since(tStart)
+
+	// a run which was abandoned, such as by a client going away or by
+	// FailFast, tells nothing about the dependency, so it's left out of the
+	// history and the breaker
+	canceled := ctx.Err() == context.Canceled
 
 	hct.Status = testStatus
-	hct.DurationMs = time.Since(tStart) / time.Millisecond
+	applyError(&hct, err)
+	hct.Details = d.sanitized()
+	hct.DurationMs = Duration(elapsed)
+
+	var runs, successes uint64
+	if canceled {
+		runs, successes = Counts(name)
+	} else {
+		recordDuration(name, elapsed)
+		runs, successes = recordResult(name, hct.Status)
+	}
+	if IncludeSuccessRate {
+		if hct.Details == nil {
+			hct.Details = map[string]interface{}{}
+		}
+		hct.Details["runs"] = runs
+		if runs > 0 {
+			hct.Details["success_rate"] = float64(successes) / float64(runs)
+		}
+	}
+	switch {
+	case reg.breaker == nil:
+	case canceled:
+		hct.Breaker = reg.breaker.abort()
+	default:
+		timedOut := ctx.Err() == context.DeadlineExceeded || (reg.timeout > 0 && elapsed >= reg.timeout)
+		hct.Breaker = reg.breaker.record(timedOut || hct.Status == Unavailable || hct.Status == TimedOut)
+	}
 
 	rspChan <- hct
 }
 
+func severity(s Status) int {
+	if s == TimedOut {
+		s = TimeoutSeverity
+	}
+
+	switch s {
+	case Unavailable:
+		return 2
+	case Degraded:
+		return 1
+	default:
+		return customStatuses[s].severity
+	}
+}
+
+// inGrace returns whether any of the tests is skipped as the StartupGrace
+// hasn't passed yet.
+func inGrace(tests map[string]*registration) bool {
+	for _, reg := range tests {
+		if reg.inGrace() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decidingTests returns the results of the tests which aren't informational.
+func decidingTests(results map[string]Test) map[string]Test {
+	tests := make(map[string]Test, len(results))
+	for name, t := range results {
+		if !t.Informational {
+			tests[name] = t
+		}
+	}
+
+	return tests
+}
+
 func getOverallStatus(statuses []Status) Status {
 	status := Available
 	for _, s := range statuses {
-		if s == Unavailable {
-			return s
+		if s == TimedOut {
+			s = TimeoutSeverity
 		}
 
-		if s == Degraded {
-			status = Degraded
+		if rank(s) > rank(status) {
+			status = s
 		}
 	}
 
 	return status
 }
 
-func defaultCheck(ctx context.Context) (Status, error) {
-	return Available, nil
+// statusOrder represents the order set through SetStatusOrder.
+var statusOrder []Status
+
+// SetStatusOrder sets the order of the statuses from best to worst, which
+// decides the overall status, replacing the order by severity. It has to
+// contain Available, Degraded, Unavailable and every status registered through
+// RegisterStatus, each of them once, or ErrInvalidStatusOrder is returned and
+// the order is left unchanged. A status registered afterwards never decides
+// the overall status until it's added to the order. Setting an empty order
+// restores the order by severity.
+func SetStatusOrder(order ...Status) error {
+	if len(order) == 0 {
+		statusOrder = nil
+		return nil
+	}
+
+	seen := map[Status]bool{}
+	for _, s := range order {
+		if seen[s] {
+			return ErrInvalidStatusOrder
+		}
+		seen[s] = true
+	}
+
+	required := []Status{Available, Degraded, Unavailable}
+	for s := range customStatuses {
+		required = append(required, s)
+	}
+	for _, s := range required {
+		if !seen[s] {
+			return ErrInvalidStatusOrder
+		}
+	}
+
+	statusOrder = order
+	return nil
 }
 
-func init() {
-	RegisterTest("default", defaultCheck)
+// rank returns the position of the status in the order which decides the
+// overall status, where the worst status has the highest rank.
+func rank(s Status) int {
+	if s == TimedOut {
+		s = TimeoutSeverity
+	}
+	if statusOrder == nil {
+		return severity(s)
+	}
+
+	for i, o := range statusOrder {
+		if o == s {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// statusLevel classifies the status by its rank as healthy (0), degraded (1) or
+// unavailable (2), for the places which map a status onto such a scale, such
+// as the weight of the instance or the Nagios output.
+func statusLevel(s Status) int {
+	switch r := rank(s); {
+	case r >= rank(Unavailable):
+		return 2
+	case r > rank(Available):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// defaultCheck is registered as the "default" test on import, unless the
+// package is built with the hcheck_nodefault build tag.
+func defaultCheck(ctx context.Context) (Status, error) {
+	return Available, nil
 }
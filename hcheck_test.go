@@ -1,33 +1,22 @@
 package hcheck
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
-func TestHealthChecks_Default(t *testing.T) {
-	hc, sc, err := getHealth()
-
-	if err != nil {
-		t.Fatalf("Expected no error, got '%s'", err.Error())
-	}
-
-	if sc != http.StatusOK {
-		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, sc)
-	}
-
-	if ln := len(hc.Tests); ln != 1 {
-		t.Fatalf("Expected '%d' tests, got '%d'", 1, ln)
-	}
-}
-
 func TestHealthChecks_Custom(t *testing.T) {
 	t.Run("with multiple tests", func(t *testing.T) {
 		defer resetTests()
@@ -97,6 +86,36 @@ func TestHealthChecks_Custom(t *testing.T) {
 		}
 	})
 
+	t.Run("with a distinct timeout status", func(t *testing.T) {
+		defer resetTests()
+
+		Timeout = 100 * time.Millisecond
+		TimeoutStatus = TimedOut
+		TimeoutSeverity = Degraded
+
+		RegisterTest("slow", func(_ context.Context) (Status, error) {
+			time.Sleep(time.Second)
+			return Available, nil
+		})
+
+		hc, sc, err := getHealth()
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if sc != http.StatusOK {
+			t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, sc)
+		}
+		if hc.Status != Degraded {
+			t.Fatalf("Expected result to equal '%s', got '%s'", Degraded, hc.Status)
+		}
+		if s := hc.Tests["slow"].Status; s != TimedOut {
+			t.Fatalf("Expected 'slow' test to equal '%s', got '%s'", TimedOut, s)
+		}
+		if hc.Tests["slow"].Error != ErrTimeout {
+			t.Fatalf("Expected 'slow' test to be timeout")
+		}
+	})
+
 	t.Run("with a failing test", func(t *testing.T) {
 		defer resetTests()
 
@@ -183,6 +202,28 @@ func TestHealthChecks_Custom(t *testing.T) {
 		}
 	})
 
+	t.Run("with a failing informational test", func(t *testing.T) {
+		defer resetTests()
+
+		RegisterTest("feature-flags", func(_ context.Context) (Status, error) {
+			return Unavailable, errors.New("unavailable")
+		}, Informational())
+
+		hc, sc, err := getHealth()
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if sc != http.StatusOK {
+			t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, sc)
+		}
+		if hc.Status != Available {
+			t.Fatalf("Expected result to equal '%s', got '%s'", Available, hc.Status)
+		}
+		if tst := hc.Tests["feature-flags"]; tst.Status != Unavailable || !tst.Informational {
+			t.Fatalf("Expected informational test to be reported as '%s', got '%+v'", Unavailable, tst)
+		}
+	})
+
 	t.Run("with a passing test", func(t *testing.T) {
 		defer resetTests()
 
@@ -207,6 +248,281 @@ func TestHealthChecks_Custom(t *testing.T) {
 	})
 }
 
+func TestHealthChecks_Summary(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("degraded", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("degraded")
+	})
+	RegisterTest("unavailable", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("unavailable")
+	})
+	RegisterTest("available", func(_ context.Context) (Status, error) {
+		return Available, nil
+	})
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	expected := Summary{Available: 2, Degraded: 1, Unavailable: 1, PercentAvailable: 50}
+	if hc.Summary == nil || *hc.Summary != expected {
+		t.Fatalf("Expected summary to equal '%+v', got '%+v'", expected, hc.Summary)
+	}
+
+	DisableSummary = true
+	hc, _, err = getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Summary != nil {
+		t.Fatalf("Expected no summary, got '%+v'", hc.Summary)
+	}
+}
+
+func TestHealthChecks_Options(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("not-run", func(_ context.Context) (Status, error) {
+		t.Errorf("Expected test not to run")
+		return Available, nil
+	})
+
+	rec := httptest.NewRecorder()
+	NewHandler(http.NewServeMux()).ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/_hcheck", nil))
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusNoContent, rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Fatalf("Expected Allow header to equal '%s', got '%s'", "GET, HEAD, OPTIONS", allow)
+	}
+}
+
+func TestHealthChecks_Runtime(t *testing.T) {
+	defer resetTests()
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Runtime != nil {
+		t.Fatalf("Expected no runtime stats by default, got '%+v'", hc.Runtime)
+	}
+
+	IncludeRuntime = true
+	hc, _, err = getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Runtime == nil || hc.Runtime.Goroutines == 0 || hc.Runtime.GOMAXPROCS == 0 {
+		t.Fatalf("Expected runtime stats, got '%+v'", hc.Runtime)
+	}
+}
+
+func TestHealthChecks_TimeoutHeader(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		select {
+		case <-time.After(time.Second):
+			return Available, nil
+		case <-ctx.Done():
+			return Unavailable, ctx.Err()
+		}
+	})
+
+	srv := httptest.NewServer(NewHandler(nil))
+	defer srv.Close()
+
+	tcs := []struct {
+		header string
+		code   int
+	}{
+		{"50ms", http.StatusServiceUnavailable},
+		{"1h", http.StatusOK},
+		{"soon", http.StatusBadRequest},
+		{"-1s", http.StatusBadRequest},
+	}
+
+	for _, tc := range tcs {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/_hcheck", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		req.Header.Set(TimeoutHeader, tc.header)
+
+		start := time.Now()
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != tc.code {
+			t.Fatalf("Expected status code for '%s' to equal '%d', got '%d'", tc.header, tc.code, rsp.StatusCode)
+		}
+		if tc.header == "50ms" && time.Since(start) > 500*time.Millisecond {
+			t.Fatalf("Expected the request to be bound by the header timeout")
+		}
+	}
+}
+
+func TestTestNameFromContext(t *testing.T) {
+	defer resetTests()
+
+	if _, ok := TestNameFromContext(context.Background()); ok {
+		t.Fatalf("Expected no test name outside of a test")
+	}
+
+	shared := func(ctx context.Context) (Status, error) {
+		if name, _ := TestNameFromContext(ctx); name == "replica" {
+			return Degraded, errors.New(name)
+		}
+		return Available, nil
+	}
+	RegisterTest("primary", shared)
+	RegisterTest("replica", shared)
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if s := hc.Tests["primary"].Status; s != Available {
+		t.Fatalf("Expected 'primary' to equal '%s', got '%s'", Available, s)
+	}
+	if e := hc.Tests["replica"].Error; e != "replica" {
+		t.Fatalf("Expected 'replica' error to equal '%s', got '%s'", "replica", e)
+	}
+}
+
+func TestHealthChecks_MaxBodyBytes(t *testing.T) {
+	defer resetTests()
+
+	for i := 0; i < 50; i++ {
+		RegisterTest(fmt.Sprintf("passing-%02d", i), func(_ context.Context) (Status, error) {
+			return Available, nil
+		})
+	}
+	RegisterTest("failing", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("unavailable")
+	})
+	MaxBodyBytes = 1024
+
+	hc, sc, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if sc != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, sc)
+	}
+	if !hc.Truncated {
+		t.Fatalf("Expected response to be truncated")
+	}
+	if ln := len(hc.Tests); ln == 0 || ln >= 52 {
+		t.Fatalf("Expected a subset of the tests, got '%d'", ln)
+	}
+	if _, ok := hc.Tests["failing"]; !ok {
+		t.Fatalf("Expected failing test to be kept")
+	}
+}
+
+func TestHealthChecks_ClientDisconnect(t *testing.T) {
+	defer resetNotify()
+	defer resetTests()
+
+	changed := false
+	OnStatusChange = func(_, _ Status, _ HealthCheck) {
+		changed = true
+	}
+
+	started := make(chan struct{})
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		close(started)
+		<-ctx.Done()
+		return Unavailable, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/_hcheck", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		NewHandler(http.NewServeMux()).ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected handler to abort after the client disconnected")
+	}
+
+	if rec.Body.Len() != 0 {
+		t.Fatalf("Expected no response to be written, got '%s'", rec.Body.String())
+	}
+	if changed {
+		t.Fatalf("Expected an aborted run not to change the status")
+	}
+}
+
+func TestNewHandler_NilPassthrough(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(nil))
+	defer srv.Close()
+
+	for path, code := range map[string]int{"/_hcheck": http.StatusOK, "/": http.StatusNotFound, "/app": http.StatusNotFound} {
+		rsp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != code {
+			t.Fatalf("Expected status code for '%s' to equal '%d', got '%d'", path, code, rsp.StatusCode)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var wrapped []string
+	mw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped = append(wrapped, r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	Register(mux, mw)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for path, code := range map[string]int{"/_hcheck": http.StatusOK, "/app": http.StatusTeapot, "/other": http.StatusNotFound} {
+		rsp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != code {
+			t.Fatalf("Expected status code for '%s' to equal '%d', got '%d'", path, code, rsp.StatusCode)
+		}
+	}
+
+	if len(wrapped) != 1 || wrapped[0] != "/_hcheck" {
+		t.Fatalf("Expected middleware to only wrap the health endpoint, got '%v'", wrapped)
+	}
+}
+
 func getHealth() (HealthCheck, int, error) {
 	hdlr := NewHandler(http.NewServeMux())
 	srv := httptest.NewServer(hdlr)
@@ -233,8 +549,1520 @@ func getHealth() (HealthCheck, int, error) {
 	return hc, 0, fmt.Errorf("Unexpected status code: %d", rsp.StatusCode)
 }
 
+// initialTests represents the tests registered on import, before any test
+// ran, as resetTests registers the "default" test whatever the build tags.
+var initialTests map[string]*registration
+
+func TestMain(m *testing.M) {
+	initialTests = registeredTests()
+	os.Exit(m.Run())
+}
+
 func resetTests() {
-	healthCheckTests = map[string]TestFunc{}
+	healthCheckTests = map[string]*registration{}
+	customStatuses = map[Status]customStatus{}
+	statusOrder = nil
+	Selector = nil
+	EncodeErrorHandler = nil
+	OmitContentType = false
+	MaxTests = 0
+	Aggregate = nil
+	EnableWeight = false
+	IncludeTestsDuration = false
+	AfterCheck = nil
+	StartupGrace = 0
+	NoMatchStatusCode = http.StatusBadRequest
 	Timeout = 5 * time.Second
+	MaxBodyBytes = 0
+	DisableSummary = false
+	IncludeRuntime = false
+	MaxInFlight = 0
+	Sequential = false
+	MaxConcurrency = 0
+	CacheTTL = 0
+	StaleWhileRevalidate = false
+	FailFast = false
+	IncludeStackTraces = false
+	ReadyOnce = false
+	readyGate = 0
+	TimeoutStatus = Unavailable
+	TimeoutSeverity = Unavailable
 	RegisterTest("default", defaultCheck)
 }
+
+func TestHealthChecks_MaxInFlight(t *testing.T) {
+	defer resetTests()
+
+	MaxInFlight = 1
+
+	started, release := make(chan struct{}), make(chan struct{})
+	RegisterTest("blocking", func(_ context.Context) (Status, error) {
+		close(started)
+		<-release
+		return Available, nil
+	})
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	done := make(chan int)
+	go func() {
+		rsp, err := http.Get(srv.URL + "/_hcheck")
+		if err != nil {
+			done <- 0
+			return
+		}
+		rsp.Body.Close()
+		done <- rsp.StatusCode
+	}()
+	<-started
+
+	rsp, err := http.Get(srv.URL + "/_hcheck")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+	close(release)
+
+	if rsp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusTooManyRequests, rsp.StatusCode)
+	}
+	if h := rsp.Header.Get("Retry-After"); h != "1" {
+		t.Fatalf("Expected Retry-After header to equal '1', got '%s'", h)
+	}
+	if h := rsp.Header.Get(StatusHeader); h != string(Unknown) {
+		t.Fatalf("Expected %s header to equal '%s', got '%s'", StatusHeader, Unknown, h)
+	}
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, code)
+	}
+}
+
+func TestHealthChecks_SuggestedStatusCode(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("upstream", func(_ context.Context) (Status, error) {
+		return Unavailable, WithStatusCode(errors.New("rate limited"), http.StatusTooManyRequests)
+	})
+	RegisterTest("cache", func(_ context.Context) (Status, error) {
+		return Degraded, WithStatusCode(errors.New("evicting"), http.StatusInternalServerError)
+	})
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	getCode := func() int {
+		rsp, err := http.Get(srv.URL + "/_hcheck")
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+		return rsp.StatusCode
+	}
+
+	if code := getCode(); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusTooManyRequests, code)
+	}
+
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("connection refused")
+	})
+	RegisterTest("api", func(_ context.Context) (Status, error) {
+		return Unavailable, WithStatusCode(errors.New("bad gateway"), http.StatusBadGateway)
+	})
+
+	if code := getCode(); code != http.StatusBadGateway {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusBadGateway, code)
+	}
+}
+
+func TestRegisterStatus(t *testing.T) {
+	defer resetTests()
+
+	maintenance, warming := Status("maintenance"), Status("warming")
+	RegisterStatus(maintenance, http.StatusServiceUnavailable, 3)
+	RegisterStatus(warming, http.StatusAccepted, 1)
+
+	tcs := []struct {
+		statuses []Status
+		expected Status
+	}{
+		{[]Status{Available, warming}, warming},
+		{[]Status{Degraded, maintenance, Unavailable}, maintenance},
+		{[]Status{Available, Unavailable, warming}, Unavailable},
+	}
+	for _, tc := range tcs {
+		if s := getOverallStatus(tc.statuses); s != tc.expected {
+			t.Fatalf("Expected overall status of '%v' to equal '%s', got '%s'", tc.statuses, tc.expected, s)
+		}
+	}
+
+	RegisterTest("cache", func(_ context.Context) (Status, error) {
+		return warming, nil
+	})
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/_hcheck")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusAccepted, rsp.StatusCode)
+	}
+	if h := rsp.Header.Get(StatusHeader); h != string(warming) {
+		t.Fatalf("Expected status header to equal '%s', got '%s'", warming, h)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("Expected registering a built-in status to panic")
+		}
+	}()
+	RegisterStatus(Degraded, http.StatusOK, 1)
+}
+
+func TestRegisterStatus_InvalidCode(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("Expected registering an invalid status code to panic")
+		}
+		if _, ok := customStatuses["maint"]; ok {
+			t.Fatalf("Expected the status not to be registered")
+		}
+	}()
+	RegisterStatus("maint", 0, 3)
+}
+
+func TestNewHandlerWithMiddleware_Order(t *testing.T) {
+	defer resetTests()
+
+	var order []string
+	mw := func(name string) MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	srv := httptest.NewServer(NewHandlerWithMiddleware(nil, mw("auth"), mw("logging"), mw("cors")))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/_hcheck")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+
+	expected := []string{"auth", "logging", "cors"}
+	if strings.Join(order, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected middleware to run in order '%v', got '%v'", expected, order)
+	}
+}
+
+func TestTryRegisterTest(t *testing.T) {
+	defer resetTests()
+
+	if err := TryRegisterTest("db", defaultCheck); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if err := TryRegisterTest("db", defaultCheck); err != ErrTestRegistered {
+		t.Fatalf("Expected error to equal '%v', got '%v'", ErrTestRegistered, err)
+	}
+}
+
+func TestTryRegisterTest_Nil(t *testing.T) {
+	defer resetTests()
+
+	if err := TryRegisterTest("db", nil); err != ErrNilTest {
+		t.Fatalf("Expected error to equal '%v', got '%v'", ErrNilTest, err)
+	}
+	if err := RegisterAll(map[string]TestFunc{"cache": defaultCheck, "db": nil}); err != ErrNilTest {
+		t.Fatalf("Expected error to equal '%v', got '%v'", ErrNilTest, err)
+	}
+	if ln := len(healthCheckTests); ln != 1 {
+		t.Fatalf("Expected '%d' tests, got '%d'", 1, ln)
+	}
+
+	// a nil test which bypassed registration is reported rather than crashing
+	healthCheckTests["db"] = &registration{}
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if tst := hc.Tests["db"]; tst.Status != Unavailable || tst.Error != ErrNilTest {
+		t.Fatalf("Expected 'db' to be '%s' with '%s', got '%+v'", Unavailable, ErrNilTest, tst)
+	}
+}
+
+func TestRegisterFor(t *testing.T) {
+	defer resetTests()
+
+	RegisterFor([]string{"ready"}, "db", defaultCheck)
+	RegisterFor([]string{"startup"}, "migrations", defaultCheck)
+
+	mux := http.NewServeMux()
+	Register(mux)
+	mux.Handle("/ready", HandlerFor("ready"))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for path, expected := range map[string][]string{
+		"/ready":   {"default", "db"},
+		"/_hcheck": {"default", "db", "migrations"},
+	} {
+		rsp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		var hc HealthCheck
+		err = json.NewDecoder(rsp.Body).Decode(&hc)
+		rsp.Body.Close()
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+
+		if len(hc.Tests) != len(expected) {
+			t.Fatalf("Expected %s to run '%v', got '%v'", path, expected, hc.Tests)
+		}
+		for _, name := range expected {
+			if _, ok := hc.Tests[name]; !ok {
+				t.Fatalf("Expected %s to run '%v', got '%v'", path, expected, hc.Tests)
+			}
+		}
+	}
+}
+
+func TestRegisterFor_SharedOptions(t *testing.T) {
+	defer resetTests()
+
+	opts := make([]TestOption, 1, 2)
+	opts[0] = WithTags("shared")
+	RegisterFor([]string{"ready"}, "db", defaultCheck, opts...)
+	RegisterFor([]string{"startup"}, "migrations", defaultCheck, opts...)
+
+	if opts[:2][1] != nil {
+		t.Fatalf("Expected the spare capacity of the caller's options to be left untouched")
+	}
+	if e := healthCheckTests["db"].endpoints; len(e) != 1 || e[0] != "ready" {
+		t.Fatalf("Expected 'db' to run on '%v', got '%v'", []string{"ready"}, e)
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("connection refused")
+	})
+
+	srv := httptest.NewServer(LivenessHandler())
+	defer srv.Close()
+
+	get := func() (HealthCheck, int) {
+		rsp, err := http.Get(srv.URL + "/livez")
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		var hc HealthCheck
+		if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return hc, rsp.StatusCode
+	}
+
+	hc, code := get()
+	if code != http.StatusOK || len(hc.Tests) != 0 {
+		t.Fatalf("Expected an empty 200 response, got '%d' '%+v'", code, hc)
+	}
+
+	RegisterTest("worker", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("deadlocked")
+	}, WithTags(LivenessTag))
+
+	hc, code = get()
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, code)
+	}
+	if _, ok := hc.Tests["db"]; ok || len(hc.Tests) != 1 {
+		t.Fatalf("Expected only the liveness test to run, got '%v'", hc.Tests)
+	}
+}
+
+func TestLivenessHandler_ReadyOnce(t *testing.T) {
+	defer resetTests()
+
+	ReadyOnce = true
+	MaxInFlight = 1
+	atomic.AddInt32(&inFlight, 1)
+	defer atomic.AddInt32(&inFlight, -1)
+
+	RegisterTest("worker", func(_ context.Context) (Status, error) {
+		return Available, nil
+	}, WithTags(LivenessTag))
+
+	srv := httptest.NewServer(LivenessHandler())
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/livez")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, rsp.StatusCode)
+	}
+
+	var hc HealthCheck
+	if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Ready != nil {
+		t.Fatalf("Expected no ready field, got '%t'", *hc.Ready)
+	}
+	if atomic.LoadInt32(&readyGate) != 0 {
+		t.Fatalf("Expected the liveness probe not to open the gate")
+	}
+}
+
+func TestRegisterAll(t *testing.T) {
+	defer resetTests()
+
+	err := RegisterAll(map[string]TestFunc{"db": defaultCheck, "cache": defaultCheck})
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if ln := len(healthCheckTests); ln != 3 {
+		t.Fatalf("Expected '%d' tests, got '%d'", 3, ln)
+	}
+
+	err = RegisterAll(map[string]TestFunc{"queue": defaultCheck, "db": defaultCheck})
+	if err != ErrTestRegistered {
+		t.Fatalf("Expected error to equal '%v', got '%v'", ErrTestRegistered, err)
+	}
+	if _, ok := healthCheckTests["queue"]; ok {
+		t.Fatalf("Expected no test to be registered when one collides")
+	}
+}
+
+func TestHealthChecks_Sequential(t *testing.T) {
+	defer resetTests()
+
+	Sequential = true
+	Timeout = 300 * time.Millisecond
+
+	var order []string
+	var l sync.Mutex
+	tst := func(d time.Duration) TestFunc {
+		return func(ctx context.Context) (Status, error) {
+			name, _ := TestNameFromContext(ctx)
+			l.Lock()
+			order = append(order, name)
+			l.Unlock()
+
+			select {
+			case <-time.After(d):
+				return Available, nil
+			case <-ctx.Done():
+				return Unavailable, ctx.Err()
+			}
+		}
+	}
+	healthCheckTests = map[string]*registration{}
+	RegisterTest("a-slow", tst(time.Second))
+	RegisterTest("b-fast", tst(10*time.Millisecond))
+	RegisterTest("c-fast", tst(10*time.Millisecond))
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	// the slow test only gets its share of the budget, leaving time for the
+	// tests after it
+	if s := hc.Tests["a-slow"].Status; s != Unavailable {
+		t.Fatalf("Expected 'a-slow' to equal '%s', got '%s'", Unavailable, s)
+	}
+	for _, name := range []string{"b-fast", "c-fast"} {
+		if s := hc.Tests[name].Status; s != Available {
+			t.Fatalf("Expected '%s' to equal '%s', got '%s'", name, Available, s)
+		}
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if strings.Join(order, ",") != "a-slow,b-fast,c-fast" {
+		t.Fatalf("Expected tests to run in order of their names, got '%v'", order)
+	}
+}
+
+func TestHealthChecks_Reason(t *testing.T) {
+	defer resetTests()
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Reason != "" {
+		t.Fatalf("Expected no reason, got '%s'", hc.Reason)
+	}
+
+	RegisterTest("cache", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("evicting")
+	})
+	RegisterTest("db_replica", func(_ context.Context) (Status, error) {
+		return Unavailable, nil
+	})
+	RegisterTest("db_primary", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("connection refused")
+	})
+
+	hc, _, err = getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if expected := "db_primary: connection refused; db_replica: unavailable"; hc.Reason != expected {
+		t.Fatalf("Expected reason to equal '%s', got '%s'", expected, hc.Reason)
+	}
+}
+
+func TestHealthChecks_FailFast(t *testing.T) {
+	defer resetTests()
+
+	FailFast = true
+	healthCheckTests = map[string]*registration{}
+
+	canceled := make(chan struct{})
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		<-ctx.Done()
+		close(canceled)
+		return Available, nil
+	})
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("connection refused")
+	})
+
+	start := time.Now()
+	hc, sc, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Expected to respond right away, took '%s'", d)
+	}
+	if sc != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, sc)
+	}
+	if s := hc.Tests["slow"].Status; s != Skipped {
+		t.Fatalf("Expected 'slow' to equal '%s', got '%s'", Skipped, s)
+	}
+	if hc.Summary.Skipped != 1 {
+		t.Fatalf("Expected '%d' skipped tests, got '%d'", 1, hc.Summary.Skipped)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the skipped test to be canceled")
+	}
+}
+
+func TestWithDescription(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("db_primary", defaultCheck, WithDescription("PostgreSQL primary connectivity"))
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if d := hc.Tests["db_primary"].Description; d != "PostgreSQL primary connectivity" {
+		t.Fatalf("Expected description to equal '%s', got '%s'", "PostgreSQL primary connectivity", d)
+	}
+	if d := hc.Tests["default"].Description; d != "" {
+		t.Fatalf("Expected no description, got '%s'", d)
+	}
+}
+
+func TestHealthChecks_Panic(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("panicking", func(_ context.Context) (Status, error) {
+		panic("secret connection string")
+	})
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	tst := hc.Tests["panicking"]
+	if tst.Status != Unavailable || tst.Error != ErrInternal {
+		t.Fatalf("Expected 'panicking' to be '%s' with '%s', got '%+v'", Unavailable, ErrInternal, tst)
+	}
+	if _, ok := tst.Details["stack"]; ok {
+		t.Fatalf("Expected no stack trace")
+	}
+
+	IncludeStackTraces = true
+
+	hc, _, err = getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	tst = hc.Tests["panicking"]
+	if tst.Error != "panic: secret connection string" {
+		t.Fatalf("Expected error to equal '%s', got '%s'", "panic: secret connection string", tst.Error)
+	}
+	if stack, _ := tst.Details["stack"].(string); !strings.Contains(stack, "callTest") {
+		t.Fatalf("Expected a stack trace, got '%s'", stack)
+	}
+}
+
+func TestHealthChecks_UnencodableDetail(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("careless", func(ctx context.Context) (Status, error) {
+		SetDetail(ctx, "conn", make(chan int))
+		SetDetail(ctx, "pool_size", 10)
+		return Degraded, errors.New("careless")
+	})
+
+	hc, code, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if code != http.StatusOK || hc.Status != Degraded {
+		t.Fatalf("Expected a degraded response, got '%d' '%s'", code, hc.Status)
+	}
+
+	tst := hc.Tests["careless"]
+	if note, _ := tst.Details["conn"].(string); !strings.HasPrefix(note, "unencodable chan int") {
+		t.Fatalf("Expected a note about the unencodable detail, got '%v'", tst.Details["conn"])
+	}
+	if n, _ := tst.Details["pool_size"].(float64); n != 10 {
+		t.Fatalf("Expected detail to equal '%d', got '%v'", 10, tst.Details["pool_size"])
+	}
+}
+
+func TestHealthChecks_ReadyOnce(t *testing.T) {
+	defer resetTests()
+
+	ReadyOnce = true
+
+	status := Degraded
+	RegisterTest("warming", func(_ context.Context) (Status, error) {
+		return status, nil
+	})
+
+	for _, tc := range []struct {
+		status Status
+		code   int
+		ready  bool
+	}{
+		{Degraded, http.StatusServiceUnavailable, false},
+		{Available, http.StatusOK, true},
+		{Degraded, http.StatusOK, true},
+	} {
+		status = tc.status
+
+		hc, code, err := getHealth()
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if code != tc.code {
+			t.Fatalf("Expected status code to equal '%d', got '%d'", tc.code, code)
+		}
+		if hc.Ready == nil || *hc.Ready != tc.ready {
+			t.Fatalf("Expected ready to equal '%t', got '%v'", tc.ready, hc.Ready)
+		}
+	}
+}
+
+func TestHandlerFor_ReadyOnce(t *testing.T) {
+	defer resetTests()
+
+	ReadyOnce = true
+
+	RegisterFor([]string{"ready"}, "db", func(_ context.Context) (Status, error) {
+		return Available, nil
+	})
+	RegisterFor([]string{"live"}, "worker", func(_ context.Context) (Status, error) {
+		return Available, nil
+	})
+
+	srv := httptest.NewServer(HandlerFor("ready"))
+	defer srv.Close()
+
+	get := func(path string) int {
+		rsp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+		return rsp.StatusCode
+	}
+
+	// a narrowed down run doesn't open the gate
+	if code := get("/ready?test=db"); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, code)
+	}
+	if code := get("/ready"); code != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, code)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	defer resetTests()
+
+	TimeoutStatus = TimedOut
+	TimeoutSeverity = Degraded
+
+	canceled := make(chan struct{})
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		<-ctx.Done()
+		close(canceled)
+		return Available, nil
+	}, WithTimeout(50*time.Millisecond))
+
+	hc, sc, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if sc != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, sc)
+	}
+	if hc.Status != Degraded {
+		t.Fatalf("Expected result to equal '%s', got '%s'", Degraded, hc.Status)
+	}
+	tst := hc.Tests["slow"]
+	if tst.Status != TimedOut || tst.Error != ErrTimeout {
+		t.Fatalf("Expected 'slow' to be '%s' with '%s', got '%+v'", TimedOut, ErrTimeout, tst)
+	}
+	if d := time.Duration(tst.DurationMs); d < 50*time.Millisecond || d > time.Second {
+		t.Fatalf("Expected 'slow' to take about 50ms, got '%s'", d)
+	}
+	if s := hc.Tests["default"].Status; s != Available {
+		t.Fatalf("Expected 'default' to equal '%s', got '%s'", Available, s)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the timed out test to be canceled")
+	}
+}
+
+func TestCheck_Canceled(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		<-ctx.Done()
+		return Unavailable, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	if _, err := check(ctx, healthCheckTests, time.Second); err != context.Canceled {
+		t.Fatalf("Expected error to equal '%v', got '%v'", context.Canceled, err)
+	}
+
+	// a canceled request doesn't get a misleading timeout response
+	req := httptest.NewRequest(http.MethodGet, "/_hcheck", nil)
+	ctx, cancel = context.WithCancel(req.Context())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	rec := httptest.NewRecorder()
+	NewHandler(nil).ServeHTTP(rec, req.WithContext(ctx))
+	if rec.Body.Len() != 0 || rec.Header().Get(StatusHeader) != "" {
+		t.Fatalf("Expected no response for a canceled request, got '%s'", rec.Body.String())
+	}
+}
+
+func TestCheck_DeadlineExceeded(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return Available, nil
+	})
+
+	// a deadline of the caller is a timeout like the Timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	hc, err := check(ctx, healthCheckTests, time.Second)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if tst := hc.Tests["slow"]; tst.Error != ErrTimeout {
+		t.Fatalf("Expected 'slow' to time out, got '%+v'", tst)
+	}
+	if hc.Status != Unavailable {
+		t.Fatalf("Expected result to equal '%s', got '%s'", Unavailable, hc.Status)
+	}
+}
+
+func TestSetStatusOrder(t *testing.T) {
+	defer resetTests()
+
+	warming := Status("warming")
+	RegisterStatus(warming, http.StatusServiceUnavailable, 1)
+
+	if err := SetStatusOrder(Available, Degraded, Unavailable); err != ErrInvalidStatusOrder {
+		t.Fatalf("Expected error to equal '%v', got '%v'", ErrInvalidStatusOrder, err)
+	}
+	if err := SetStatusOrder(Available, warming, Degraded, Degraded, Unavailable); err != ErrInvalidStatusOrder {
+		t.Fatalf("Expected error to equal '%v', got '%v'", ErrInvalidStatusOrder, err)
+	}
+
+	if s := getOverallStatus([]Status{Degraded, warming}); s != Degraded {
+		t.Fatalf("Expected the first of equally severe statuses to win, got '%s'", s)
+	}
+	if err := SetStatusOrder(Available, Degraded, warming, Unavailable); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	tcs := []struct {
+		statuses []Status
+		expected Status
+	}{
+		{[]Status{Degraded, warming}, warming},
+		{[]Status{warming, Unavailable}, Unavailable},
+		{[]Status{Available, Degraded}, Degraded},
+		{[]Status{Available, Skipped}, Available},
+	}
+	for _, tc := range tcs {
+		if s := getOverallStatus(tc.statuses); s != tc.expected {
+			t.Fatalf("Expected overall status of '%v' to equal '%s', got '%s'", tc.statuses, tc.expected, s)
+		}
+	}
+
+	// the rest of the response follows the order too
+	hc := HealthCheck{Status: warming, Tests: map[string]Test{
+		"db":    {Name: "db", Status: Degraded, Error: "slow"},
+		"cache": {Name: "cache", Status: warming, Error: "cold"},
+	}}
+	if r := reason(hc); r != "cache: cold" {
+		t.Fatalf("Expected reason to equal '%s', got '%s'", "cache: cold", r)
+	}
+	if l := statusLevel(warming); l != 1 {
+		t.Fatalf("Expected level to equal '%d', got '%d'", 1, l)
+	}
+}
+
+func TestInFlightTests(t *testing.T) {
+	defer resetTests()
+
+	Timeout = 20 * time.Millisecond
+
+	// tests of other cases may still be finishing up in the background
+	base := InFlightTests()
+
+	release := make(chan struct{})
+	RegisterTest("leaking", func(_ context.Context) (Status, error) {
+		<-release
+		return Available, nil
+	})
+
+	if _, _, err := getHealth(); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if n := InFlightTests() - base; n < 1 {
+		t.Fatalf("Expected the test to outlive the request, got '%d' tests in flight", n)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for InFlightTests() > base && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := InFlightTests() - base; n > 0 {
+		t.Fatalf("Expected the test to finish, got '%d' tests in flight", n)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("acme-db", func(_ context.Context) (Status, error) {
+		return Available, nil
+	})
+	RegisterTest("globex-db", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("globex-db")
+	})
+
+	Selector = func(r *http.Request) []string {
+		tenant := r.Header.Get("X-Tenant")
+		return []string{tenant + "-db", "missing"}
+	}
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	get := func(tenant string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/_hcheck", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		req.Header.Set("X-Tenant", tenant)
+
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return rsp
+	}
+
+	rsp := get("acme")
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, rsp.StatusCode)
+	}
+	var hc HealthCheck
+	if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if len(hc.Tests) != 1 || hc.Tests["acme-db"].Name != "acme-db" {
+		t.Fatalf("Expected only test '%s' to run, got '%v'", "acme-db", hc.Tests)
+	}
+
+	rsp = get("globex")
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, rsp.StatusCode)
+	}
+
+	rsp = get("initech")
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusBadRequest, rsp.StatusCode)
+	}
+}
+
+func TestRegisterOrReplace(t *testing.T) {
+	defer resetTests()
+
+	if RegisterOrReplace("db", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("db")
+	}) {
+		t.Fatalf("Expected a new test not to replace any")
+	}
+
+	if !RegisterOrReplace("db", func(_ context.Context) (Status, error) {
+		return Available, nil
+	}) {
+		t.Fatalf("Expected the test to be replaced")
+	}
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if s := hc.Tests["db"].Status; s != Available {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Available, s)
+	}
+}
+
+func TestRegisterOrReplace_Concurrent(t *testing.T) {
+	defer resetTests()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterOrReplace("db", func(_ context.Context) (Status, error) {
+				return Available, nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			if _, _, err := getHealth(); err != nil {
+				t.Errorf("Expected no error, got '%s'", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOmitContentType(t *testing.T) {
+	defer resetTests()
+
+	OmitContentType = true
+
+	var ct []string
+	proxy := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/health+json")
+			next.ServeHTTP(w, r)
+			ct = w.Header().Values("Content-Type")
+		})
+	}
+
+	srv := httptest.NewServer(NewHandlerWithMiddleware(http.NewServeMux(), proxy))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/_hcheck")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+
+	if len(ct) != 1 || ct[0] != "application/health+json" {
+		t.Fatalf("Expected content type to equal '%s', got '%v'", "application/health+json", ct)
+	}
+	if got := rsp.Header.Get("Content-Type"); got != "application/health+json" {
+		t.Fatalf("Expected content type to equal '%s', got '%s'", "application/health+json", got)
+	}
+}
+
+func TestTimeout_Partial(t *testing.T) {
+	defer resetTests()
+
+	Timeout = 50 * time.Millisecond
+
+	RegisterTest("fast", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("fast")
+	})
+	RegisterTest("slow", func(ctx context.Context) (Status, error) {
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+		return Available, nil
+	}, WithComponent("storage"))
+
+	start := time.Now()
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("Expected the health check to stop at the timeout, took '%s'", d)
+	}
+
+	if s := hc.Tests["fast"].Status; s != Degraded {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Degraded, s)
+	}
+	if s := hc.Tests["default"].Status; s != Available {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Available, s)
+	}
+
+	slow := hc.Tests["slow"]
+	if slow.Status != TimeoutStatus || slow.Error != ErrTimeout {
+		t.Fatalf("Expected test '%s' to time out, got '%s' '%s'", "slow", slow.Status, slow.Error)
+	}
+	if slow.Component != "storage" {
+		t.Fatalf("Expected component to equal '%s', got '%s'", "storage", slow.Component)
+	}
+	if d := time.Duration(slow.DurationMs); d < Timeout || d > Timeout+40*time.Millisecond {
+		t.Fatalf("Expected the duration to be the elapsed time, got '%s'", d)
+	}
+}
+
+func TestWeightHeader(t *testing.T) {
+	defer resetTests()
+
+	EnableWeight = true
+
+	var status atomic.Value
+	status.Store(Available)
+	for _, name := range []string{"a", "b", "c"} {
+		RegisterTest(name, func(_ context.Context) (Status, error) {
+			return Available, nil
+		})
+	}
+	RegisterTest("d", func(_ context.Context) (Status, error) {
+		return status.Load().(Status), nil
+	})
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		status   Status
+		expected string
+	}{
+		{Available, "100"},
+		{Degraded, "80"},
+		{Unavailable, "0"},
+	} {
+		status.Store(tc.status)
+
+		rsp, err := http.Get(srv.URL + "/_hcheck")
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+
+		if w := rsp.Header.Get(WeightHeader); w != tc.expected {
+			t.Fatalf("Expected weight to equal '%s', got '%s'", tc.expected, w)
+		}
+	}
+}
+
+func TestOnTimeout(t *testing.T) {
+	defer resetTests()
+
+	Timeout = 50 * time.Millisecond
+
+	slow := func(ctx context.Context) (Status, error) {
+		<-ctx.Done()
+		return Available, nil
+	}
+	RegisterTest("payment", slow, WithTimeout(10*time.Millisecond), OnTimeout(Degraded, errors.New("payment gateway slow")))
+	RegisterTest("search", slow, OnTimeout(Degraded, errors.New("search slow")))
+	RegisterTest("db", slow, WithTimeout(10*time.Millisecond))
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	for name, expected := range map[string]Test{
+		"payment": {Status: Degraded, Error: "payment gateway slow"},
+		"search":  {Status: Degraded, Error: "search slow"},
+		"db":      {Status: TimeoutStatus, Error: ErrTimeout},
+	} {
+		if tst := hc.Tests[name]; tst.Status != expected.Status || tst.Error != expected.Error {
+			t.Fatalf("Expected test '%s' to be '%s' with '%s', got '%s' '%s'", name, expected.Status, expected.Error, tst.Status, tst.Error)
+		}
+	}
+	if hc.Status != Unavailable {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Unavailable, hc.Status)
+	}
+}
+
+func TestIncludeTestsDuration(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("slow", func(_ context.Context) (Status, error) {
+		time.Sleep(20 * time.Millisecond)
+		return Available, nil
+	})
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.TestsDurationMs != 0 {
+		t.Fatalf("Expected no tests duration, got '%s'", time.Duration(hc.TestsDurationMs))
+	}
+
+	IncludeTestsDuration = true
+
+	hc, _, err = getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if d := time.Duration(hc.TestsDurationMs); d < 20*time.Millisecond || d > time.Duration(hc.DurationMs) {
+		t.Fatalf("Expected the tests duration to be within the duration '%s', got '%s'", time.Duration(hc.DurationMs), d)
+	}
+}
+
+func TestAfterCheck(t *testing.T) {
+	defer resetTests()
+
+	Timeout = 20 * time.Millisecond
+
+	release := make(chan struct{})
+	defer close(release)
+	RegisterTest("slow", func(_ context.Context) (Status, error) {
+		<-release
+		return Available, nil
+	})
+
+	unblock := make(chan struct{})
+	statuses := make(chan Status, 1)
+	AfterCheck = func(hc HealthCheck) {
+		<-unblock
+		statuses <- hc.Tests["slow"].Status
+	}
+
+	// the response doesn't wait for the hook
+	if _, _, err := getHealth(); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	close(unblock)
+
+	select {
+	case s := <-statuses:
+		if s != TimeoutStatus {
+			t.Fatalf("Expected the timed out result, got '%v'", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the hook to be called")
+	}
+}
+
+func TestAfterGrace(t *testing.T) {
+	defer resetTests()
+	defer func(t time.Time) {
+		startedAt = t
+	}(startedAt)
+
+	ReadyOnce = true
+	StartupGrace = time.Minute
+	startedAt = time.Now()
+
+	var runs int32
+	RegisterFor([]string{"ready"}, "search", func(_ context.Context) (Status, error) {
+		atomic.AddInt32(&runs, 1)
+		return Available, nil
+	}, AfterGrace())
+
+	srv := httptest.NewServer(HandlerFor("ready"))
+	defer srv.Close()
+
+	get := func() (int, HealthCheck) {
+		rsp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		var hc HealthCheck
+		if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return rsp.StatusCode, hc
+	}
+
+	code, hc := get()
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, code)
+	}
+	if tst := hc.Tests["search"]; tst.Status != Skipped || tst.Error != ErrStartupGrace {
+		t.Fatalf("Expected test '%s' to be skipped, got '%s' '%s'", "search", tst.Status, tst.Error)
+	}
+	if n := atomic.LoadInt32(&runs); n != 0 {
+		t.Fatalf("Expected no runs during the grace, got '%d'", n)
+	}
+
+	startedAt = time.Now().Add(-2 * time.Minute)
+
+	code, hc = get()
+	if code != http.StatusOK || hc.Tests["search"].Status != Available {
+		t.Fatalf("Expected an available response after the grace, got '%d' '%s'", code, hc.Tests["search"].Status)
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("Expected '%d' run, got '%d'", 1, n)
+	}
+}
+
+func TestNoMatchStatusCode(t *testing.T) {
+	defer resetTests()
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		code     int
+		query    string
+		expected int
+	}{
+		{http.StatusBadRequest, "?test=missing", http.StatusBadRequest},
+		{http.StatusNotFound, "?test=missing", http.StatusNotFound},
+		{http.StatusNotFound, "?test=%5B", http.StatusBadRequest},
+		{http.StatusNotFound, "?test=default", http.StatusOK},
+		{0, "?test=missing", http.StatusBadRequest},
+	} {
+		NoMatchStatusCode = tc.code
+
+		rsp, err := http.Get(srv.URL + "/_hcheck" + tc.query)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != tc.expected {
+			t.Fatalf("Expected status code of '%s' to equal '%d', got '%d'", tc.query, tc.expected, rsp.StatusCode)
+		}
+		if h := rsp.Header.Get(StatusHeader); h == "" {
+			t.Fatalf("Expected %s header of '%s' to be set", StatusHeader, tc.query)
+		}
+	}
+}
+
+func TestHealthChecks_StatusHeader(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("degraded", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("degraded")
+	})
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		req, err := http.NewRequest(method, srv.URL+"/_hcheck", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+
+		if h := rsp.Header.Get(StatusHeader); h != string(Degraded) {
+			t.Fatalf("Expected %s header to equal '%s', got '%s'", method, Degraded, h)
+		}
+		if rsp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %s status code to equal '%d', got '%d'", method, http.StatusOK, rsp.StatusCode)
+		}
+		if h, expected := rsp.Header.Get("Warning"), `199 - "degraded: degraded"`; h != expected {
+			t.Fatalf("Expected %s Warning header to equal '%s', got '%s'", method, expected, h)
+		}
+	}
+}
+
+func TestHealthChecks_HeadMatchesGet(t *testing.T) {
+	for _, status := range []Status{Available, Degraded, Unavailable} {
+		t.Run(string(status), func(t *testing.T) {
+			defer resetTests()
+
+			RegisterTest("dependency", func(_ context.Context) (Status, error) {
+				return status, nil
+			})
+
+			srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+			defer srv.Close()
+
+			rsps := map[string]*http.Response{}
+			for _, method := range []string{http.MethodGet, http.MethodHead} {
+				req, err := http.NewRequest(method, srv.URL+"/_hcheck", nil)
+				if err != nil {
+					t.Fatalf("Expected no error, got '%s'", err.Error())
+				}
+				rsp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatalf("Expected no error, got '%s'", err.Error())
+				}
+				rsp.Body.Close()
+				rsps[method] = rsp
+			}
+
+			get, head := rsps[http.MethodGet], rsps[http.MethodHead]
+			if get.StatusCode != head.StatusCode {
+				t.Fatalf("Expected HEAD status code to equal '%d', got '%d'", get.StatusCode, head.StatusCode)
+			}
+			for _, h := range []string{StatusHeader, "Warning", "Content-Type"} {
+				if get.Header.Get(h) != head.Header.Get(h) {
+					t.Fatalf("Expected HEAD %s header to equal '%s', got '%s'", h, get.Header.Get(h), head.Header.Get(h))
+				}
+			}
+		})
+	}
+}
+
+func TestHealthChecks_NoWarningWhenAvailable(t *testing.T) {
+	defer resetTests()
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/_hcheck")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+
+	if h := rsp.Header.Get("Warning"); h != "" {
+		t.Fatalf("Expected no Warning header, got '%s'", h)
+	}
+}
+
+func TestHealthChecks_Filter(t *testing.T) {
+	defer resetTests()
+
+	for _, name := range []string{"db.primary", "db.replica1", "cache"} {
+		RegisterTest(name, func(_ context.Context) (Status, error) {
+			return Available, nil
+		})
+	}
+	RegisterTest("s3", func(_ context.Context) (Status, error) {
+		return Available, nil
+	}, WithTags("external", "storage"))
+	RegisterTest("stripe", func(_ context.Context) (Status, error) {
+		return Available, nil
+	}, WithTags("external"))
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	tcs := []struct {
+		query string
+		code  int
+		tests []string
+	}{
+		{"test=cache", http.StatusOK, []string{"cache"}},
+		{"test=db.*", http.StatusOK, []string{"db.primary", "db.replica1"}},
+		{"test=db.replica?&test=cache", http.StatusOK, []string{"db.replica1", "cache"}},
+		{"tag=storage", http.StatusOK, []string{"s3"}},
+		{"tag=external", http.StatusOK, []string{"s3", "stripe"}},
+		{"tag=external&test=st*", http.StatusOK, []string{"stripe"}},
+		{"tag=unknown", http.StatusBadRequest, nil},
+		{"test=unknown", http.StatusBadRequest, nil},
+		{"test=%5B", http.StatusBadRequest, nil},
+	}
+
+	for _, tc := range tcs {
+		rsp, err := http.Get(srv.URL + "/_hcheck?" + tc.query)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+
+		if rsp.StatusCode != tc.code {
+			rsp.Body.Close()
+			t.Fatalf("Expected status code for '%s' to equal '%d', got '%d'", tc.query, tc.code, rsp.StatusCode)
+		}
+
+		if tc.code == http.StatusOK {
+			hc := HealthCheck{}
+			if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+				t.Fatalf("Expected no error, got '%s'", err.Error())
+			}
+			if ln := len(hc.Tests); ln != len(tc.tests) {
+				t.Fatalf("Expected '%d' tests for '%s', got '%d'", len(tc.tests), tc.query, ln)
+			}
+			for _, name := range tc.tests {
+				if _, ok := hc.Tests[name]; !ok {
+					t.Fatalf("Expected test '%s' for '%s'", name, tc.query)
+				}
+			}
+		}
+		rsp.Body.Close()
+	}
+}
+
+func TestHealthChecks_Components(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("disk", func(_ context.Context) (Status, error) {
+		return Available, nil
+	}, WithComponent("storage"))
+	RegisterTest("s3", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("degraded")
+	}, WithComponent("storage"))
+	RegisterTest("postgres", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("unavailable")
+	}, WithComponent("database"))
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/_hcheck/components/storage")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, rsp.StatusCode)
+	}
+
+	hc := HealthCheck{}
+	if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if ln := len(hc.Tests); ln != 2 {
+		t.Fatalf("Expected '%d' tests, got '%d'", 2, ln)
+	}
+	if hc.Status != Degraded {
+		t.Fatalf("Expected result to equal '%s', got '%s'", Degraded, hc.Status)
+	}
+	if c := hc.Tests["s3"].Component; c != "storage" {
+		t.Fatalf("Expected component to equal '%s', got '%s'", "storage", c)
+	}
+
+	rsp, err = http.Get(srv.URL + "/_hcheck/components/unknown")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusNotFound, rsp.StatusCode)
+	}
+}
+
+func TestMaxTests(t *testing.T) {
+	defer resetTests()
+
+	var logs bytes.Buffer
+	Logger = log.New(&logs, "", 0)
+	defer func() {
+		Logger = log.New(os.Stderr, "hcheck: ", log.LstdFlags)
+	}()
+
+	healthCheckTests = map[string]*registration{}
+	MaxTests = 2
+
+	for _, name := range []string{"a", "b"} {
+		RegisterTest(name, defaultCheck)
+	}
+	if logs.Len() > 0 {
+		t.Fatalf("Expected no warning within the limit, got '%s'", logs.String())
+	}
+
+	RegisterTest("c", defaultCheck)
+	if !strings.Contains(logs.String(), "3 tests are registered") {
+		t.Fatalf("Expected a warning to be logged, got '%s'", logs.String())
+	}
+	if n := Count(); n != 3 {
+		t.Fatalf("Expected '%d' tests, got '%d'", 3, n)
+	}
+}
+
+func TestNoopHandler(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("failing", func(_ context.Context) (Status, error) {
+		t.Fatalf("Expected test not to run")
+		return Unavailable, nil
+	})
+
+	var logs bytes.Buffer
+	Logger = log.New(&logs, "", 0)
+	defer func() {
+		Logger = log.New(os.Stderr, "hcheck: ", log.LstdFlags)
+	}()
+
+	srv := httptest.NewServer(NewNoopHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	if !strings.Contains(logs.String(), "WARNING") {
+		t.Fatalf("Expected a warning to be logged, got '%s'", logs.String())
+	}
+
+	rsp, err := http.Get(srv.URL + "/_hcheck")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, rsp.StatusCode)
+	}
+
+	hc := HealthCheck{}
+	if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Status != Available {
+		t.Fatalf("Expected result to equal '%s', got '%s'", Available, hc.Status)
+	}
+	if ln := len(hc.Tests); ln != 0 {
+		t.Fatalf("Expected '%d' tests, got '%d'", 0, ln)
+	}
+}
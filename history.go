@@ -0,0 +1,220 @@
+package hcheck
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IncludeSuccessRate adds the number of runs of every test since the start of
+// the process, and the fraction of them which were Available, to its details
+// as runs and success_rate, which reveals a flaky test which happens to pass
+// right now.
+var IncludeSuccessRate = false
+
+// HistorySize represents the amount of test durations which are retained per
+// test to compute the statistics returned by Stats. A value of zero disables
+// the history.
+var HistorySize = 100
+
+var (
+	historyMu sync.Mutex
+	history   = map[string]*durations{}
+
+	// lastHealthy and lastHealthyAt represent when each test, and the service
+	// as a whole, were last Available
+	lastHealthy   = map[string]time.Time{}
+	lastHealthyAt time.Time
+
+	// counts represents the number of runs of each test since the start
+	counts = map[string]*runCounts{}
+)
+
+// runCounts represents the number of runs of a test, and of the ones which
+// were Available.
+type runCounts struct {
+	runs      uint64
+	successes uint64
+}
+
+// Counts returns the number of runs of the test with the given name since the
+// start of the process, and of the ones which were Available.
+func Counts(name string) (runs, successes uint64) {
+	historyMu.Lock()
+	c, ok := counts[name]
+	historyMu.Unlock()
+	if !ok {
+		return 0, 0
+	}
+
+	// successes are loaded first, so they never exceed the runs
+	successes = atomic.LoadUint64(&c.successes)
+	return atomic.LoadUint64(&c.runs), successes
+}
+
+// recordResult counts a run of the test, and returns the new counts.
+func recordResult(name string, status Status) (runs, successes uint64) {
+	historyMu.Lock()
+	c, ok := counts[name]
+	if !ok {
+		c = &runCounts{}
+		counts[name] = c
+	}
+	historyMu.Unlock()
+
+	runs = atomic.AddUint64(&c.runs, 1)
+	if status == Available {
+		return runs, atomic.AddUint64(&c.successes, 1)
+	}
+	return runs, atomic.LoadUint64(&c.successes)
+}
+
+// TestStats represents the duration statistics of a test over its retained
+// history.
+type TestStats struct {
+	Runs int           `json:"runs"`
+	Min  time.Duration `json:"min"`
+	Max  time.Duration `json:"max"`
+	P50  time.Duration `json:"p50"`
+	P95  time.Duration `json:"p95"`
+}
+
+// durations represents a ring buffer of test durations.
+type durations struct {
+	values []time.Duration
+	next   int
+}
+
+func (d *durations) add(v time.Duration, size int) {
+	if len(d.values) < size {
+		d.values = append(d.values, v)
+		return
+	}
+
+	// the history size could've shrunk since the buffer was filled
+	d.values = d.values[:size]
+	d.next %= size
+	d.values[d.next] = v
+	d.next = (d.next + 1) % size
+}
+
+// Stats returns the duration statistics of the test with the given name, over
+// the last HistorySize runs. It returns false when the test hasn't run yet.
+func Stats(name string) (TestStats, bool) {
+	historyMu.Lock()
+	d, ok := history[name]
+	if !ok || len(d.values) == 0 {
+		historyMu.Unlock()
+		return TestStats{}, false
+	}
+	values := make([]time.Duration, len(d.values))
+	copy(values, d.values)
+	historyMu.Unlock()
+
+	stats := TestStats{
+		Runs: len(values),
+		Min:  values[0],
+		Max:  values[0],
+	}
+	for _, v := range values {
+		if v < stats.Min {
+			stats.Min = v
+		}
+		if v > stats.Max {
+			stats.Max = v
+		}
+	}
+
+	stats.P50 = percentile(values, 0.5)
+	stats.P95 = percentile(values, 0.95)
+
+	return stats, true
+}
+
+func recordDuration(name string, d time.Duration) {
+	if HistorySize <= 0 {
+		return
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	h, ok := history[name]
+	if !ok {
+		h = &durations{}
+		history[name] = h
+	}
+	h.add(d, HistorySize)
+}
+
+// percentile returns the nearest-rank percentile p of the given values. The
+// values are reordered in place.
+func percentile(values []time.Duration, p float64) time.Duration {
+	k := int(math.Ceil(p*float64(len(values)))) - 1
+	if k < 0 {
+		k = 0
+	}
+
+	return selectNth(values, k)
+}
+
+// selectNth returns the k-th smallest value using quickselect, which runs in
+// linear time on average.
+func selectNth(values []time.Duration, k int) time.Duration {
+	lo, hi := 0, len(values)-1
+	for lo < hi {
+		pivot := values[(lo+hi)/2]
+		i, j := lo, hi
+		for i <= j {
+			for values[i] < pivot {
+				i++
+			}
+			for values[j] > pivot {
+				j--
+			}
+			if i <= j {
+				values[i], values[j] = values[j], values[i]
+				i++
+				j--
+			}
+		}
+
+		switch {
+		case k <= j:
+			hi = j
+		case k >= i:
+			lo = i
+		default:
+			return values[k]
+		}
+	}
+
+	return values[k]
+}
+
+// recordHealthy tracks when the tests of the health check, and the health
+// check as a whole when it ran every test, were last Available, and attaches
+// those times to it.
+func recordHealthy(hc *HealthCheck, full bool) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	for name, test := range hc.Tests {
+		if test.Status == Available {
+			lastHealthy[name] = hc.CheckedAt
+		}
+		if at, ok := lastHealthy[name]; ok {
+			test.LastHealthyAt = &at
+			hc.Tests[name] = test
+		}
+	}
+
+	if full && hc.Status == Available {
+		lastHealthyAt = hc.CheckedAt
+	}
+	if !lastHealthyAt.IsZero() {
+		at := lastHealthyAt
+		hc.LastHealthyAt = &at
+	}
+}
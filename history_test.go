@@ -0,0 +1,167 @@
+package hcheck
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHistory_Stats(t *testing.T) {
+	defer resetHistory()
+
+	if _, ok := Stats("unknown"); ok {
+		t.Fatalf("Expected no stats for an unknown test")
+	}
+
+	HistorySize = 10
+	for i := 1; i <= 20; i++ {
+		recordDuration("db", time.Duration(i)*time.Millisecond)
+	}
+
+	stats, ok := Stats("db")
+	if !ok {
+		t.Fatalf("Expected stats for 'db'")
+	}
+
+	// only the last 10 runs, 11ms up to 20ms, are retained
+	if stats.Runs != 10 {
+		t.Fatalf("Expected '%d' runs, got '%d'", 10, stats.Runs)
+	}
+	if stats.Min != 11*time.Millisecond {
+		t.Fatalf("Expected min to equal '%s', got '%s'", 11*time.Millisecond, stats.Min)
+	}
+	if stats.Max != 20*time.Millisecond {
+		t.Fatalf("Expected max to equal '%s', got '%s'", 20*time.Millisecond, stats.Max)
+	}
+	if stats.P50 != 15*time.Millisecond {
+		t.Fatalf("Expected p50 to equal '%s', got '%s'", 15*time.Millisecond, stats.P50)
+	}
+	if stats.P95 != 20*time.Millisecond {
+		t.Fatalf("Expected p95 to equal '%s', got '%s'", 20*time.Millisecond, stats.P95)
+	}
+}
+
+func TestHistory_SelectNth(t *testing.T) {
+	values := []time.Duration{5, 1, 4, 1, 3, 9, 2, 6}
+	sorted := []time.Duration{1, 1, 2, 3, 4, 5, 6, 9}
+
+	for k, expected := range sorted {
+		cp := append([]time.Duration{}, values...)
+		if v := selectNth(cp, k); v != expected {
+			t.Fatalf("Expected value '%d' to equal '%d', got '%d'", k, expected, v)
+		}
+	}
+}
+
+func resetHistory() {
+	historyMu.Lock()
+	history = map[string]*durations{}
+	lastHealthy = map[string]time.Time{}
+	lastHealthyAt = time.Time{}
+	counts = map[string]*runCounts{}
+	historyMu.Unlock()
+	IncludeSuccessRate = false
+	HistorySize = 100
+}
+
+func TestHistory_LastHealthyAt(t *testing.T) {
+	resetHistory()
+	defer resetHistory()
+	defer resetTests()
+
+	status := Available
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		return status, nil
+	})
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.LastHealthyAt == nil || !hc.LastHealthyAt.Equal(hc.CheckedAt) {
+		t.Fatalf("Expected last healthy at to equal '%s', got '%v'", hc.CheckedAt, hc.LastHealthyAt)
+	}
+	healthyAt := hc.CheckedAt
+
+	status = Unavailable
+	hc, _, err = getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.LastHealthyAt == nil || !hc.LastHealthyAt.Equal(healthyAt) {
+		t.Fatalf("Expected last healthy at to equal '%s', got '%v'", healthyAt, hc.LastHealthyAt)
+	}
+	if at := hc.Tests["db"].LastHealthyAt; at == nil || !at.Equal(healthyAt) {
+		t.Fatalf("Expected 'db' last healthy at to equal '%s', got '%v'", healthyAt, at)
+	}
+	if at := hc.Tests["default"].LastHealthyAt; at == nil || !at.Equal(hc.CheckedAt) {
+		t.Fatalf("Expected 'default' last healthy at to equal '%s', got '%v'", hc.CheckedAt, at)
+	}
+}
+
+func TestHistory_Counts(t *testing.T) {
+	resetHistory()
+	defer resetHistory()
+	defer resetTests()
+
+	var calls int32
+	RegisterTest("flaky", func(_ context.Context) (Status, error) {
+		if atomic.AddInt32(&calls, 1)%2 == 0 {
+			return Unavailable, errors.New("flaky")
+		}
+		return Available, nil
+	})
+	IncludeSuccessRate = true
+
+	var hc HealthCheck
+	for i := 0; i < 4; i++ {
+		var err error
+		if hc, _, err = getHealth(); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	}
+
+	if runs, successes := Counts("flaky"); runs != 4 || successes != 2 {
+		t.Fatalf("Expected '%d' runs and '%d' successes, got '%d' '%d'", 4, 2, runs, successes)
+	}
+	if rate := hc.Tests["flaky"].Details["success_rate"]; rate != 0.5 {
+		t.Fatalf("Expected success rate to equal '%g', got '%v'", 0.5, rate)
+	}
+	if runs := hc.Tests["flaky"].Details["runs"]; runs != float64(4) {
+		t.Fatalf("Expected runs to equal '%d', got '%v'", 4, runs)
+	}
+	if runs, _ := Counts("unknown"); runs != 0 {
+		t.Fatalf("Expected no runs for an unknown test, got '%d'", runs)
+	}
+}
+
+func TestHistory_Canceled(t *testing.T) {
+	resetHistory()
+	defer resetHistory()
+	defer resetTests()
+
+	HistorySize = 10
+	returned := make(chan struct{}, 1)
+	RegisterTest("healthy", func(ctx context.Context) (Status, error) {
+		defer func() { returned <- struct{}{} }()
+		<-ctx.Done()
+		return Unavailable, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := check(ctx, registeredTests(), Timeout); err != context.Canceled {
+		t.Fatalf("Expected error to equal '%v', got '%v'", context.Canceled, err)
+	}
+	<-returned
+	time.Sleep(10 * time.Millisecond)
+
+	if runs, _ := Counts("healthy"); runs != 0 {
+		t.Fatalf("Expected a canceled run not to be counted, got '%d' runs", runs)
+	}
+	if _, ok := Stats("healthy"); ok {
+		t.Fatalf("Expected a canceled run not to be recorded")
+	}
+}
@@ -0,0 +1,105 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MaxValidatedBodyBytes represents the amount of the response body which is
+// read by BodyContains and JSONField.
+var MaxValidatedBodyBytes int64 = 1 << 20
+
+// HTTPCheck returns a TestFunc which sends the given request with
+// http.DefaultClient and reports Available when the dependency responds with a
+// 2xx status code, and Unavailable otherwise. The request is sent with the
+// context of the test.
+func HTTPCheck(req *http.Request) TestFunc {
+	return HTTPCheckWithValidator(req, nil)
+}
+
+// HTTPCheckWithValidator returns a TestFunc like HTTPCheck, which also passes
+// the response to the validator, to catch a misconfigured dependency which
+// serves the wrong thing with a 200. The test is Unavailable when the
+// validator returns an error, or the status carried by the error when it's
+// wrapped with WithStatus, e.g. Degraded. The response body is closed once the
+// validator returns.
+func HTTPCheckWithValidator(req *http.Request, validate func(*http.Response) error) TestFunc {
+	return func(ctx context.Context) (Status, error) {
+		SetDetail(ctx, "url", req.URL.String())
+
+		rsp, err := http.DefaultClient.Do(req.Clone(ctx))
+		if err != nil {
+			return Unavailable, err
+		}
+		defer rsp.Body.Close()
+		SetDetail(ctx, "status_code", rsp.StatusCode)
+
+		if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+			return Unavailable, fmt.Errorf("unexpected status code %d", rsp.StatusCode)
+		}
+
+		if validate == nil {
+			return Available, nil
+		}
+
+		if err := validate(rsp); err != nil {
+			var se *StatusError
+			if errors.As(err, &se) {
+				return se.Status, err
+			}
+			return Unavailable, err
+		}
+
+		return Available, nil
+	}
+}
+
+// BodyContains returns a validator for HTTPCheckWithValidator which requires
+// the response body to contain the given substring.
+func BodyContains(substr string) func(*http.Response) error {
+	return func(rsp *http.Response) error {
+		body, err := io.ReadAll(io.LimitReader(rsp.Body, MaxValidatedBodyBytes))
+		if err != nil {
+			return err
+		}
+
+		if !strings.Contains(string(body), substr) {
+			return fmt.Errorf("response body doesn't contain %q", substr)
+		}
+
+		return nil
+	}
+}
+
+// JSONField returns a validator for HTTPCheckWithValidator which requires the
+// response body to be a JSON object whose field at the given dot-separated
+// path, such as "db.status", renders as the given value.
+func JSONField(path, want string) func(*http.Response) error {
+	return func(rsp *http.Response) error {
+		var v interface{}
+		if err := json.NewDecoder(io.LimitReader(rsp.Body, MaxValidatedBodyBytes)).Decode(&v); err != nil {
+			return fmt.Errorf("invalid JSON response: %s", err)
+		}
+
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("response has no field %q", path)
+			}
+			if v, ok = obj[key]; !ok {
+				return fmt.Errorf("response has no field %q", path)
+			}
+		}
+
+		if got := fmt.Sprint(v); got != want {
+			return fmt.Errorf("field %q is %q, expected %q", path, got, want)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+package hcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPCheckWithValidator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte(`{"db":{"status":"up"},"version":"1.2.0"}`))
+		}
+	}))
+	defer srv.Close()
+
+	tcs := []struct {
+		path     string
+		validate func(*http.Response) error
+		expected Status
+	}{
+		{"/", nil, Available},
+		{"/missing", nil, Unavailable},
+		{"/", BodyContains(`"version"`), Available},
+		{"/", BodyContains("<html>"), Unavailable},
+		{"/", JSONField("db.status", "up"), Available},
+		{"/", JSONField("db.status", "down"), Unavailable},
+		{"/", JSONField("cache.status", "up"), Unavailable},
+		{"/", func(rsp *http.Response) error {
+			return WithStatus(JSONField("version", "2.0.0")(rsp), Degraded)
+		}, Degraded},
+	}
+
+	for _, tc := range tcs {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+tc.path, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+
+		s, err := HTTPCheckWithValidator(req, tc.validate)(context.Background())
+		if s != tc.expected {
+			t.Fatalf("Expected status to equal '%s', got '%s' '%v'", tc.expected, s, err)
+		}
+		if (s == Available) != (err == nil) {
+			t.Fatalf("Expected an error only when not available, got '%v'", err)
+		}
+	}
+}
+
+func TestHTTPCheck_Context(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if s, err := HTTPCheck(req)(ctx); s != Unavailable || err == nil {
+		t.Fatalf("Expected a canceled request to be unavailable, got '%s' '%v'", s, err)
+	}
+}
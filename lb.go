@@ -0,0 +1,122 @@
+package hcheck
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LBOptions represents the options of the handler returned by NewLBHandler.
+type LBOptions struct {
+	// Timeout represents the duration after which the tests time out. Load
+	// balancers usually give up on a probe quickly, so it defaults to one
+	// second.
+	Timeout time.Duration
+
+	// CacheTTL represents the duration a result is reused for, so frequent
+	// probes from several load balancer nodes don't each run the tests. It
+	// defaults to one second.
+	CacheTTL time.Duration
+}
+
+// NewLBHandler returns a handler tuned for load balancer probes. It responds
+// to GET and HEAD requests on any path with 200 OK and a tiny plain text body
+// while the service is available or degraded, and with 503 Service Unavailable
+// otherwise, or while the gate of ReadyOnce hasn't opened yet. It doesn't
+// expose any details about the tests.
+//
+// Results are reused for the CacheTTL, including the ones of a request to the
+// regular endpoint or of StartBackground, and concurrent probes share a single
+// run of the tests.
+func NewLBHandler(opts LBOptions) http.Handler {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = time.Second
+	}
+
+	return &lbHandler{opts: opts}
+}
+
+type lbHandler struct {
+	opts LBOptions
+
+	mu        sync.Mutex
+	status    Status
+	ready     bool
+	checkedAt time.Time
+}
+
+func (h *lbHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handleOptions(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, ok := h.currentStatus(r)
+	if !ok {
+		// the client went away, there's nobody left to respond to
+		return
+	}
+	if state.ran != nil {
+		// tracked like handleResponse does, once the response has been
+		// written and without holding the lock other probes wait for
+		defer trackStatus(*state.ran)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if !state.ready || statusLevel(state.status) == 2 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unavailable\n"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
+
+// lbState represents the state the handler responds with.
+type lbState struct {
+	status Status
+	ready  bool
+
+	// ran represents the result of the tests when the request ran them
+	ran *HealthCheck
+}
+
+// currentStatus returns the cached status and whether the gate of ReadyOnce
+// has opened, or runs the tests when they're expired. It returns false when
+// the request is canceled while running them.
+func (h *lbHandler) currentStatus(r *http.Request) (lbState, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if !h.checkedAt.IsZero() && now.Sub(h.checkedAt) < h.opts.CacheTTL {
+		return lbState{status: h.status, ready: h.ready}, true
+	}
+
+	if hc, ok := latestCheck(); ok && now.Sub(hc.CheckedAt) < h.opts.CacheTTL {
+		h.cache(hc)
+		return lbState{status: h.status, ready: h.ready}, true
+	}
+
+	hc, err := check(r.Context(), registeredTests(), h.opts.Timeout)
+	if err != nil {
+		return lbState{}, false
+	}
+
+	h.cache(hc)
+	return lbState{status: h.status, ready: h.ready, ran: &hc}, true
+}
+
+// cache stores the result of the health check for the CacheTTL.
+func (h *lbHandler) cache(hc HealthCheck) {
+	h.status, h.ready, h.checkedAt = hc.Status, hc.Ready == nil || *hc.Ready, hc.CheckedAt
+}
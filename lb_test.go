@@ -0,0 +1,148 @@
+package hcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewLBHandler(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+
+	var runs int32
+	var status atomic.Value
+	status.Store(Degraded)
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		atomic.AddInt32(&runs, 1)
+		return status.Load().(Status), errors.New("db")
+	})
+
+	srv := httptest.NewServer(NewLBHandler(LBOptions{CacheTTL: 50 * time.Millisecond}))
+	defer srv.Close()
+
+	get := func(method string) (*http.Response, string) {
+		req, err := http.NewRequest(method, srv.URL+"/healthz", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		body, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return rsp, string(body)
+	}
+
+	rsp, body := get(http.MethodGet)
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, rsp.StatusCode)
+	}
+	if body != "ok\n" {
+		t.Fatalf("Expected body to equal '%s', got '%s'", "ok\n", body)
+	}
+
+	rsp, body = get(http.MethodHead)
+	if rsp.StatusCode != http.StatusOK || body != "" {
+		t.Fatalf("Expected an empty 200 response, got '%d' '%s'", rsp.StatusCode, body)
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("Expected '%d' runs, got '%d'", 1, n)
+	}
+
+	status.Store(Unavailable)
+	time.Sleep(60 * time.Millisecond)
+
+	rsp, body = get(http.MethodGet)
+	if rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, rsp.StatusCode)
+	}
+	if body != "unavailable\n" {
+		t.Fatalf("Expected body to equal '%s', got '%s'", "unavailable\n", body)
+	}
+
+	rsp, _ = get(http.MethodPost)
+	if rsp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusMethodNotAllowed, rsp.StatusCode)
+	}
+}
+
+func TestNewLBHandler_ReadyOnce(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+
+	ReadyOnce = true
+	RegisterTest("warming", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("warming up")
+	})
+
+	srv := httptest.NewServer(NewLBHandler(LBOptions{}))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, rsp.StatusCode)
+	}
+}
+
+func TestNewLBHandler_OnStatusChange(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+
+	unblock := make(chan struct{})
+	called := make(chan struct{})
+	OnStatusChange = func(_, _ Status, _ HealthCheck) {
+		close(called)
+		<-unblock
+	}
+
+	srv := httptest.NewServer(NewLBHandler(LBOptions{CacheTTL: time.Minute}))
+	defer srv.Close()
+
+	go func() {
+		if rsp, err := http.Get(srv.URL + "/healthz"); err == nil {
+			rsp.Body.Close()
+		}
+	}()
+	<-called
+
+	// the hook of the first probe doesn't hold up the next one
+	done := make(chan int, 1)
+	go func() {
+		rsp, err := http.Get(srv.URL + "/healthz")
+		if err != nil {
+			done <- 0
+			return
+		}
+		rsp.Body.Close()
+		done <- rsp.StatusCode
+	}()
+
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the probe not to wait for the hook")
+	}
+	close(unblock)
+}
@@ -0,0 +1,67 @@
+package hcheck
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// LogResults logs every run of all registered tests, such as by a request
+	// or StartBackground, as structured JSON through the ResultLogger, which
+	// keeps a history of the results in the logs. Runs are logged at the info
+	// level while Available, at the warn level while Degraded, and at the
+	// error level otherwise.
+	LogResults = false
+
+	// ResultLogger represents the logger the results are logged with when
+	// LogResults is set. When nil, a JSON logger writing to the standard
+	// error is used.
+	ResultLogger *slog.Logger
+
+	// LogResultsInterval represents the minimum duration between two logged
+	// runs, so a high probe rate doesn't flood the logs. A run which changes
+	// the overall status is always logged. A value of zero logs every run.
+	LogResultsInterval = 10 * time.Second
+)
+
+var (
+	logMu        sync.Mutex
+	loggedAt     time.Time
+	loggedStatus Status
+	jsonLogger   = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+)
+
+// logResult logs the result of a run of all registered tests, unless it's
+// within the LogResultsInterval of the previous one with the same status.
+func logResult(hc HealthCheck) {
+	if !LogResults {
+		return
+	}
+
+	logMu.Lock()
+	now := time.Now()
+	if hc.Status == loggedStatus && LogResultsInterval > 0 && now.Sub(loggedAt) < LogResultsInterval {
+		logMu.Unlock()
+		return
+	}
+	loggedAt, loggedStatus = now, hc.Status
+	logMu.Unlock()
+
+	level := slog.LevelInfo
+	switch statusLevel(hc.Status) {
+	case 0:
+	case 1:
+		level = slog.LevelWarn
+	default:
+		level = slog.LevelError
+	}
+
+	logger := ResultLogger
+	if logger == nil {
+		logger = jsonLogger
+	}
+	logger.Log(context.Background(), level, "health check", slog.String("status", string(hc.Status)), slog.Any("health_check", hc))
+}
@@ -0,0 +1,62 @@
+package hcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLogResults(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+
+	var status atomic.Value
+	status.Store(Available)
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		return status.Load().(Status), nil
+	})
+
+	var logs bytes.Buffer
+	LogResults = true
+	ResultLogger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	for _, s := range []Status{Available, Available, Degraded} {
+		status.Store(s)
+		if _, _, err := getHealth(); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	}
+
+	// the second run is within the interval of the first one
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected '%d' logged runs, got '%d'", 2, len(lines))
+	}
+
+	for i, expected := range []struct {
+		level  string
+		status Status
+	}{
+		{"INFO", Available},
+		{"WARN", Degraded},
+	} {
+		var entry struct {
+			Level       string      `json:"level"`
+			HealthCheck HealthCheck `json:"health_check"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if entry.Level != expected.level || entry.HealthCheck.Status != expected.status {
+			t.Fatalf("Expected a '%s' entry with '%s', got '%s' '%s'", expected.level, expected.status, entry.Level, entry.HealthCheck.Status)
+		}
+		if _, ok := entry.HealthCheck.Tests["db"]; !ok {
+			t.Fatalf("Expected the tests to be logged, got '%v'", entry.HealthCheck.Tests)
+		}
+	}
+}
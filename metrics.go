@@ -0,0 +1,89 @@
+package hcheck
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metricsPath represents the path, relative to the health check endpoint, on
+// which the metrics are served.
+const metricsPath = "/metrics"
+
+// EnableMetrics serves the results of the last run of all registered tests in
+// the Prometheus text exposition format on /_hcheck/metrics. The metrics
+// endpoint never runs the tests itself, so it reports nothing until the health
+// endpoint has been requested. It has to be set before registering the
+// handler.
+var EnableMetrics = false
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	// the metrics are made of the names and statuses of the tests
+	if isRedacted(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	hc, ok := latestCheck()
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(hc.Tests))
+	for name := range hc.Tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# HELP healthcheck_status Overall status of the last health check.\n")
+	b.WriteString("# TYPE healthcheck_status gauge\n")
+	fmt.Fprintf(&b, "healthcheck_status{status=\"%s\"} 1\n", escapeLabel(string(hc.Status)))
+
+	b.WriteString("# HELP healthcheck_test_status Status of a test in the last health check.\n")
+	b.WriteString("# TYPE healthcheck_test_status gauge\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "healthcheck_test_status{test=\"%s\",status=\"%s\"} 1\n", escapeLabel(name), escapeLabel(string(hc.Tests[name].Status)))
+	}
+
+	b.WriteString("# HELP healthcheck_test_duration_seconds Duration of a test in the last health check.\n")
+	b.WriteString("# TYPE healthcheck_test_duration_seconds gauge\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "healthcheck_test_duration_seconds{test=\"%s\"} %g\n", escapeLabel(name), time.Duration(hc.Tests[name].DurationMs).Seconds())
+	}
+
+	b.WriteString("# HELP healthcheck_test_runs_total Runs of a test since the start of the process.\n")
+	b.WriteString("# TYPE healthcheck_test_runs_total counter\n")
+	successes := make([]uint64, len(names))
+	for i, name := range names {
+		var runs uint64
+		runs, successes[i] = Counts(name)
+		fmt.Fprintf(&b, "healthcheck_test_runs_total{test=\"%s\"} %d\n", escapeLabel(name), runs)
+	}
+
+	b.WriteString("# HELP healthcheck_test_successes_total Runs of a test which were available since the start of the process.\n")
+	b.WriteString("# TYPE healthcheck_test_successes_total counter\n")
+	for i, name := range names {
+		fmt.Fprintf(&b, "healthcheck_test_successes_total{test=\"%s\"} %d\n", escapeLabel(name), successes[i])
+	}
+
+	b.WriteString("# HELP healthcheck_registered_tests Number of registered tests.\n")
+	b.WriteString("# TYPE healthcheck_registered_tests gauge\n")
+	fmt.Fprintf(&b, "healthcheck_registered_tests %d\n", Count())
+
+	b.WriteString("# HELP healthcheck_inflight_goroutines Tests currently running, including the ones which outlived their request.\n")
+	b.WriteString("# TYPE healthcheck_inflight_goroutines gauge\n")
+	fmt.Fprintf(&b, "healthcheck_inflight_goroutines %d\n", InFlightTests())
+
+	w.Write([]byte(b.String()))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
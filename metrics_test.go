@@ -0,0 +1,70 @@
+package hcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	resetNotify()
+	defer resetNotify()
+	defer resetTests()
+	defer func() {
+		EnableMetrics = false
+	}()
+
+	EnableMetrics = true
+	calls := 0
+	RegisterTest(`s3 "eu"`, func(_ context.Context) (Status, error) {
+		calls++
+		return Degraded, errors.New("degraded")
+	})
+
+	srv := httptest.NewServer(NewHandler(nil))
+	defer srv.Close()
+
+	get := func(path string) string {
+		rsp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		b, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return string(b)
+	}
+
+	if body := get("/_hcheck/metrics"); body != "" {
+		t.Fatalf("Expected no metrics before the first run, got '%s'", body)
+	}
+
+	get("/_hcheck")
+	body := get("/_hcheck/metrics")
+
+	for _, line := range []string{
+		`healthcheck_status{status="degraded"} 1`,
+		`healthcheck_test_status{test="default",status="available"} 1`,
+		`healthcheck_test_status{test="s3 \"eu\"",status="degraded"} 1`,
+		`healthcheck_test_duration_seconds{test="default"} `,
+		`healthcheck_test_runs_total{test="s3 \"eu\""} `,
+		`healthcheck_test_successes_total{test="s3 \"eu\""} `,
+		"healthcheck_registered_tests 2\n",
+		"healthcheck_inflight_goroutines ",
+	} {
+		if !strings.Contains(body, line) {
+			t.Fatalf("Expected metrics to contain '%s', got '%s'", line, body)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("Expected the metrics endpoint not to run the tests, got '%d' calls", calls)
+	}
+}
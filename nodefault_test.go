@@ -0,0 +1,11 @@
+//go:build hcheck_nodefault
+
+package hcheck
+
+import "testing"
+
+func TestHealthChecks_NoDefault(t *testing.T) {
+	if ln := len(initialTests); ln != 0 {
+		t.Fatalf("Expected no tests to be registered on import, got '%d'", ln)
+	}
+}
@@ -0,0 +1,258 @@
+package hcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// OnStatusChange is called whenever the overall status of a run of all
+	// registered tests differs from the previous run, subject to the
+	// StatusChangeWindow. For the first run, from is empty. It's called
+	// synchronously after the response has been written, so it shouldn't
+	// block.
+	OnStatusChange StatusChangeFunc
+
+	// WebhookTimeout represents the duration after which a single webhook
+	// delivery attempt is aborted.
+	WebhookTimeout = 5 * time.Second
+
+	// WebhookRetries represents the amount of times a failed webhook delivery
+	// is retried.
+	WebhookRetries = 3
+
+	// WebhookDebounce represents the duration the status has to remain
+	// unchanged before a webhook is delivered. Transitions within this window
+	// are collapsed into a single delivery of the latest status.
+	WebhookDebounce = time.Second
+
+	// StatusChangeWindow represents the minimum duration between two calls of
+	// OnStatusChange. A transition within the window of the previous call is
+	// held back until the first run after the window, and dropped when the
+	// status has changed back by then, so a flapping status doesn't flood logs
+	// and alerts. A value of zero reports every transition.
+	StatusChangeWindow time.Duration
+)
+
+var (
+	statusMu   sync.Mutex
+	lastStatus Status
+	lastCheck  HealthCheck
+
+	// lastNotified and lastNotifiedAt represent the status last reported
+	// through OnStatusChange and when it was reported
+	lastNotified   Status
+	lastNotifiedAt time.Time
+
+	// statusVersion counts the changes of the overall status, and
+	// statusChanged is closed on the next one
+	statusVersion uint64
+	statusChanged = make(chan struct{})
+)
+
+// StatusChangeFunc represents a function which is called when the overall
+// status of the health check changes.
+type StatusChangeFunc func(from, to Status, hc HealthCheck)
+
+func trackStatus(hc HealthCheck) {
+	logResult(hc)
+
+	from, notify := recordStatus(hc)
+	if notify != nil {
+		// called without holding statusMu, so the hook may call Snapshot or
+		// run the tests itself
+		notify(from, hc.Status, hc)
+	}
+}
+
+// recordStatus stores the result of a run and returns the StatusChangeFunc to
+// call with the previous status, which is nil when there's nothing to report.
+func recordStatus(hc HealthCheck) (Status, StatusChangeFunc) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	if hc.Status != lastStatus {
+		statusVersion++
+		close(statusChanged)
+		statusChanged = make(chan struct{})
+	}
+	lastStatus = hc.Status
+	lastCheck = hc
+	if hc.Status == lastNotified {
+		return "", nil
+	}
+
+	now := time.Now()
+	if StatusChangeWindow > 0 && !lastNotifiedAt.IsZero() && now.Sub(lastNotifiedAt) < StatusChangeWindow {
+		return "", nil
+	}
+
+	from := lastNotified
+	lastNotified, lastNotifiedAt = hc.Status, now
+	return from, OnStatusChange
+}
+
+// latestCheck returns the result of the last run of all registered tests. It
+// returns false when there hasn't been such a run yet.
+func latestCheck() (HealthCheck, bool) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	return lastCheck, lastStatus != ""
+}
+
+// watchState returns the result of the last run of all registered tests, the
+// version of its status, which is zero before the first run, and a channel
+// which is closed when the status changes.
+func watchState() (HealthCheck, uint64, <-chan struct{}) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	return lastCheck, statusVersion, statusChanged
+}
+
+// Snapshot returns the result of the last run of all registered tests without
+// running any of them, for embedding the status in the process itself, such as
+// an admin page. Its tests are marked as Cached. Before the first run, its
+// status is Unknown. The details of the tests are shared and must not be
+// modified.
+func Snapshot() HealthCheck {
+	hc, ok := latestCheck()
+	if !ok {
+		return HealthCheck{SchemaVersion: SchemaVersion, Status: Unknown}
+	}
+
+	return cached(hc, time.Now())
+}
+
+// cached returns a copy of the health check with its tests marked as cached.
+func cached(hc HealthCheck, now time.Time) HealthCheck {
+	age := Duration(now.Sub(hc.CheckedAt))
+
+	tests := make(map[string]Test, len(hc.Tests))
+	for name, test := range hc.Tests {
+		test.Cached, test.AgeMs = true, age
+		tests[name] = test
+	}
+	hc.Tests = tests
+
+	return hc
+}
+
+// WebhookNotifier returns a StatusChangeFunc which POSTs the HealthCheck as
+// JSON to the given URL. Deliveries happen asynchronously, are debounced by
+// WebhookDebounce and retried WebhookRetries times, so they never affect the
+// health check response. WebhookTimeout, WebhookRetries and WebhookDebounce
+// are read once, when the notifier is created. When client is nil,
+// http.DefaultClient is used.
+func WebhookNotifier(url string, client *http.Client) StatusChangeFunc {
+	return newWebhook(url, client).notify
+}
+
+func newWebhook(url string, client *http.Client) *webhook {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &webhook{
+		url:      url,
+		client:   client,
+		timeout:  WebhookTimeout,
+		retries:  WebhookRetries,
+		debounce: WebhookDebounce,
+	}
+}
+
+type webhook struct {
+	url      string
+	client   *http.Client
+	timeout  time.Duration
+	retries  int
+	debounce time.Duration
+
+	// wg tracks the scheduled and running deliveries
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending HealthCheck
+	sent    Status
+}
+
+func (wh *webhook) notify(_, _ Status, hc HealthCheck) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.pending = hc
+	if wh.timer != nil && wh.timer.Stop() {
+		wh.wg.Done()
+	}
+	wh.wg.Add(1)
+	wh.timer = time.AfterFunc(wh.debounce, func() {
+		defer wh.wg.Done()
+		wh.flush()
+	})
+}
+
+// wait blocks until the scheduled deliveries are done.
+func (wh *webhook) wait() {
+	wh.wg.Wait()
+}
+
+func (wh *webhook) flush() {
+	wh.mu.Lock()
+	hc := wh.pending
+	if hc.Status == wh.sent {
+		// the status flapped back before the debounce expired
+		wh.mu.Unlock()
+		return
+	}
+	wh.sent = hc.Status
+	wh.mu.Unlock()
+
+	body, err := json.Marshal(hc)
+	if err != nil {
+		Logger.Printf("webhook: encoding health check: %s", err)
+		return
+	}
+
+	for attempt := 0; attempt <= wh.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+		}
+
+		if err = wh.deliver(body); err == nil {
+			return
+		}
+	}
+
+	Logger.Printf("webhook: delivering to %s: %s", wh.url, err)
+}
+
+func (wh *webhook) deliver(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wh.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := wh.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", rsp.StatusCode)
+	}
+
+	return nil
+}
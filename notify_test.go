@@ -0,0 +1,236 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOnStatusChange(t *testing.T) {
+	resetNotify()
+	defer resetNotify()
+	defer resetTests()
+
+	var changes []Status
+	OnStatusChange = func(from, to Status, _ HealthCheck) {
+		changes = append(changes, from, to)
+	}
+
+	status := Available
+	RegisterTest("toggle", func(_ context.Context) (Status, error) {
+		return status, nil
+	})
+
+	for _, s := range []Status{Available, Available, Degraded, Degraded} {
+		status = s
+		if _, _, err := getHealth(); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	}
+
+	expected := []Status{"", Available, Available, Degraded}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected changes to equal '%v', got '%v'", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("Expected changes to equal '%v', got '%v'", expected, changes)
+		}
+	}
+}
+
+func TestOnStatusChange_Window(t *testing.T) {
+	resetNotify()
+	defer resetNotify()
+	defer resetTests()
+
+	StatusChangeWindow = 100 * time.Millisecond
+
+	var changes []Status
+	OnStatusChange = func(from, to Status, _ HealthCheck) {
+		changes = append(changes, from, to)
+	}
+
+	status := Degraded
+	RegisterTest("flapping", func(_ context.Context) (Status, error) {
+		return status, nil
+	})
+
+	for _, s := range []Status{Degraded, Available, Degraded, Available} {
+		status = s
+		if _, _, err := getHealth(); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, _, err := getHealth(); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	expected := []Status{"", Degraded, Degraded, Available}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected changes to equal '%v', got '%v'", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("Expected changes to equal '%v', got '%v'", expected, changes)
+		}
+	}
+}
+
+func TestOnStatusChange_Snapshot(t *testing.T) {
+	resetNotify()
+	defer resetNotify()
+	defer resetTests()
+
+	var snapshot HealthCheck
+	OnStatusChange = func(_, _ Status, _ HealthCheck) {
+		snapshot = Snapshot()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := getHealth()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the hook to be able to call Snapshot")
+	}
+
+	if snapshot.Status != Available {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Available, snapshot.Status)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+
+	if s := Snapshot().Status; s != Unknown {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Unknown, s)
+	}
+
+	RegisterTest("degraded", func(_ context.Context) (Status, error) {
+		return Degraded, nil
+	})
+	if _, _, err := getHealth(); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	hc := Snapshot()
+	if hc.Status != Degraded {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Degraded, hc.Status)
+	}
+	if tst, ok := hc.Tests["degraded"]; !ok || !tst.Cached {
+		t.Fatalf("Expected the snapshot to contain cached test 'degraded', got '%+v'", tst)
+	}
+	if tst, _ := latestCheck(); tst.Tests["degraded"].Cached {
+		t.Fatalf("Expected the tracked result to be left untouched")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	defer resetNotify()
+
+	WebhookDebounce = 50 * time.Millisecond
+
+	var (
+		l        sync.Mutex
+		received []HealthCheck
+		attempts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Lock()
+		defer l.Unlock()
+
+		// fail the first delivery to exercise the retries
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		hc := HealthCheck{}
+		if err := json.NewDecoder(r.Body).Decode(&hc); err != nil {
+			t.Errorf("Expected no error, got '%s'", err.Error())
+		}
+		received = append(received, hc)
+	}))
+	defer srv.Close()
+
+	wh := newWebhook(srv.URL, nil)
+	wh.notify("", Available, HealthCheck{Status: Available})
+	wh.notify(Available, Unavailable, HealthCheck{Status: Unavailable})
+	wh.notify(Unavailable, Degraded, HealthCheck{Status: Degraded})
+	wh.wait()
+
+	l.Lock()
+	defer l.Unlock()
+	if ln := len(received); ln != 1 {
+		t.Fatalf("Expected '%d' deliveries, got '%d'", 1, ln)
+	}
+	if received[0].Status != Degraded {
+		t.Fatalf("Expected delivered status to equal '%s', got '%s'", Degraded, received[0].Status)
+	}
+}
+
+func TestWebhookNotifier_Unreachable(t *testing.T) {
+	defer resetNotify()
+
+	WebhookDebounce = time.Millisecond
+	WebhookRetries = 0
+	wh := newWebhook("http://127.0.0.1:1", nil)
+	OnStatusChange = wh.notify
+
+	defer resetTests()
+	RegisterTest("failing", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("unavailable")
+	})
+
+	_, sc, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if sc != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, sc)
+	}
+
+	// the delivery must not outlive the test
+	wh.wait()
+}
+
+func resetNotify() {
+	statusMu.Lock()
+	lastStatus = ""
+	lastCheck = HealthCheck{}
+	lastNotified = ""
+	lastNotifiedAt = time.Time{}
+	statusVersion = 0
+	OnStatusChange = nil
+	statusMu.Unlock()
+
+	WebhookTimeout = 5 * time.Second
+	WebhookRetries = 3
+	WebhookDebounce = time.Second
+	StatusChangeWindow = 0
+
+	logMu.Lock()
+	loggedAt, loggedStatus = time.Time{}, ""
+	logMu.Unlock()
+	LogResults = false
+	ResultLogger = nil
+	LogResultsInterval = 10 * time.Second
+}
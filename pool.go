@@ -0,0 +1,76 @@
+package hcheck
+
+import (
+	"context"
+	"sync"
+)
+
+// job represents a test to be run by the worker pool.
+type job struct {
+	ctx     context.Context
+	name    string
+	reg     *registration
+	rspChan chan Test
+}
+
+// pool represents a worker pool of MaxConcurrency workers.
+type pool struct {
+	size int
+	jobs chan job
+
+	// senders tracks the health checks which may still submit jobs, so the
+	// queue is only closed once they're done with it
+	senders sync.WaitGroup
+}
+
+var (
+	poolMu      sync.Mutex
+	currentPool *pool
+)
+
+// acquirePool returns the worker pool with the given number of workers,
+// starting it when it doesn't exist yet. A pool of another size is replaced,
+// and stops once the health checks using it have submitted their jobs and its
+// workers have run them. The caller has to release the pool once it has
+// submitted its jobs.
+func acquirePool(size int) *pool {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	if currentPool == nil || currentPool.size != size {
+		if old := currentPool; old != nil {
+			go old.stop()
+		}
+
+		currentPool = &pool{size: size, jobs: make(chan job, size)}
+		for i := 0; i < size; i++ {
+			go work(currentPool.jobs)
+		}
+	}
+	currentPool.senders.Add(1)
+
+	return currentPool
+}
+
+// release tells the pool the caller won't submit any more jobs.
+func (p *pool) release() {
+	p.senders.Done()
+}
+
+// stop closes the queue of the pool, which stops its workers, once all of its
+// senders have released it.
+func (p *pool) stop() {
+	p.senders.Wait()
+	close(p.jobs)
+}
+
+func work(jobs <-chan job) {
+	for j := range jobs {
+		// the health check already gave up on the test
+		if j.ctx.Err() != nil {
+			continue
+		}
+
+		runTest(j.ctx, j.name, j.reg, j.rspChan)
+	}
+}
@@ -0,0 +1,109 @@
+package hcheck
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthChecks_MaxConcurrency(t *testing.T) {
+	defer resetTests()
+
+	MaxConcurrency = 2
+	Timeout = 200 * time.Millisecond
+
+	var running, peak int32
+	healthCheckTests = map[string]*registration{}
+	for i := 0; i < 6; i++ {
+		RegisterTest("test"+strconv.Itoa(i), func(_ context.Context) (Status, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			return Available, nil
+		})
+	}
+	RegisterTest("hanging", func(ctx context.Context) (Status, error) {
+		<-ctx.Done()
+		return Available, nil
+	}, WithTimeout(20*time.Millisecond))
+
+	hc, _, err := getHealth()
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if ln := len(hc.Tests); ln != 7 {
+		t.Fatalf("Expected '%d' tests, got '%d'", 7, ln)
+	}
+	for i := 0; i < 6; i++ {
+		if s := hc.Tests["test"+strconv.Itoa(i)].Status; s != Available {
+			t.Fatalf("Expected 'test%d' to equal '%s', got '%s'", i, Available, s)
+		}
+	}
+	if s := hc.Tests["hanging"].Status; s != TimeoutStatus {
+		t.Fatalf("Expected 'hanging' to equal '%s', got '%s'", TimeoutStatus, s)
+	}
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Fatalf("Expected at most '%d' tests to run at once, got '%d'", 2, p)
+	}
+}
+
+func TestAcquirePool_Resize(t *testing.T) {
+	p := acquirePool(2)
+	p.release()
+
+	q := acquirePool(3)
+	q.release()
+	if q == p || q.size != 3 {
+		t.Fatalf("Expected a pool of '%d' workers to replace the old one", 3)
+	}
+
+	select {
+	case _, ok := <-p.jobs:
+		if ok {
+			t.Fatalf("Expected no jobs in the old pool")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the old pool to be stopped")
+	}
+
+	if r := acquirePool(3); r != q {
+		t.Fatalf("Expected the pool to be reused")
+	} else {
+		r.release()
+	}
+}
+
+func benchmarkCheck(b *testing.B, concurrency int) {
+	defer resetTests()
+
+	MaxConcurrency = concurrency
+	healthCheckTests = map[string]*registration{}
+	for i := 0; i < 20; i++ {
+		RegisterTest("test"+strconv.Itoa(i), defaultCheck)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := check(context.Background(), healthCheckTests, Timeout); err != nil {
+			b.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	}
+}
+
+func BenchmarkCheck_GoroutinePerTest(b *testing.B) {
+	benchmarkCheck(b, 0)
+}
+
+func BenchmarkCheck_WorkerPool(b *testing.B) {
+	benchmarkCheck(b, 8)
+}
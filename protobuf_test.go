@@ -0,0 +1,127 @@
+package hcheck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProtobufSerializer_RoundTrip(t *testing.T) {
+	ready := true
+	healthyAt := time.Unix(1577934245, 0)
+	hc := HealthCheck{
+		SchemaVersion:   SchemaVersion,
+		CheckedAt:       time.Unix(1577934245, 123),
+		DurationMs:      Duration(12345 * time.Microsecond),
+		TestsDurationMs: Duration(12 * time.Millisecond),
+		Status:          Degraded,
+		Reason:          "s3: degraded",
+		Ready:           &ready,
+		LastHealthyAt:   &healthyAt,
+		Truncated:       true,
+		Tests: map[string]Test{
+			"db": {
+				Name:       "db",
+				DurationMs: Duration(3 * time.Millisecond),
+				Status:     Available,
+				Details:    map[string]interface{}{"replica": "eu-1", "lag_ms": float64(12)},
+			},
+			"s3": {
+				Name:          "s3",
+				Description:   "Object storage",
+				Component:     "storage",
+				Tags:          []string{"storage", "aws"},
+				Status:        Degraded,
+				Error:         "slow",
+				Errors:        []Error{"slow", "throttled"},
+				Code:          "S3_SLOW",
+				Breaker:       "closed",
+				Informational: true,
+				Cached:        true,
+				AgeMs:         Duration(time.Second),
+				LastHealthyAt: &healthyAt,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := (ProtobufSerializer{}).Serialize(&buf, hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	var decoded HealthCheck
+	if err := UnmarshalProtobuf(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if !reflect.DeepEqual(decoded, hc) {
+		t.Fatalf("Expected the decoded health check to equal '%+v', got '%+v'", hc, decoded)
+	}
+}
+
+func TestUnmarshalProtobuf_Invalid(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x0a, 0x05, 'a'},
+		{0x00},
+		{0x19, 0x01},
+	} {
+		var hc HealthCheck
+		if err := UnmarshalProtobuf(b, &hc); err != ErrInvalidProtobuf {
+			t.Fatalf("Expected error to equal '%v', got '%v'", ErrInvalidProtobuf, err)
+		}
+	}
+
+	// unknown fields are skipped
+	var hc HealthCheck
+	if err := UnmarshalProtobuf([]byte{0xa0, 0x06, 0x01, 0x22, 0x02, 'u', 'p'}, &hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Status != "up" {
+		t.Fatalf("Expected status to equal '%s', got '%s'", "up", hc.Status)
+	}
+}
+
+func TestProtobufSerializer_Accept(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("s3", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("degraded")
+	})
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/_hcheck", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	req.Header.Set("Accept", "application/x-protobuf")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if ct := rsp.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Fatalf("Expected content type to equal '%s', got '%s'", "application/x-protobuf", ct)
+	}
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	var hc HealthCheck
+	if err := UnmarshalProtobuf(body, &hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Status != Degraded || hc.Tests["s3"].Error != "degraded" {
+		t.Fatalf("Expected the health check to be decoded, got '%+v'", hc)
+	}
+}
@@ -0,0 +1,48 @@
+package hcheck
+
+import (
+	"context"
+	"net/http"
+)
+
+type redactKey struct{}
+
+// RedactMiddleware returns middleware which strips the response down to its
+// overall status for callers which aren't authorized to see the details of the
+// tests, such as anonymous probes behind a public load balancer. The status
+// code is the same either way. Authorized callers, for which the predicate
+// returns true, get the full response.
+//
+// So that unauthorized callers can't enumerate the tests through status codes
+// either, the tag and test query parameters are ignored for them, the
+// component scoped endpoints respond with 404 Not Found and the metrics
+// endpoint with 403 Forbidden.
+func RedactMiddleware(authorized func(*http.Request) bool) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !authorized(r) {
+				r = r.WithContext(context.WithValue(r.Context(), redactKey{}, true))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isRedacted(r *http.Request) bool {
+	redacted, _ := r.Context().Value(redactKey{}).(bool)
+	return redacted
+}
+
+// redact returns the health check without anything but its overall status.
+func redact(hc HealthCheck) HealthCheck {
+	return HealthCheck{
+		SchemaVersion: hc.SchemaVersion,
+		CheckedAt:     hc.CheckedAt,
+		DurationMs:    hc.DurationMs,
+		Status:        hc.Status,
+		Ready:         hc.Ready,
+		Stale:         hc.Stale,
+		Tests:         map[string]Test{},
+	}
+}
@@ -0,0 +1,113 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactMiddleware(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("db_primary", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("dial tcp 10.0.0.12:5432: connection refused")
+	})
+
+	internal := func(r *http.Request) bool {
+		return r.Header.Get("X-Internal") != ""
+	}
+	srv := httptest.NewServer(NewHandlerWithMiddleware(nil, RedactMiddleware(internal)))
+	defer srv.Close()
+
+	get := func(header string) (HealthCheck, int) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/_hcheck", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if header != "" {
+			req.Header.Set("X-Internal", header)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		var hc HealthCheck
+		if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return hc, rsp.StatusCode
+	}
+
+	hc, code := get("")
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, code)
+	}
+	if hc.Status != Unavailable {
+		t.Fatalf("Expected result to equal '%s', got '%s'", Unavailable, hc.Status)
+	}
+	if len(hc.Tests) != 0 || hc.Reason != "" {
+		t.Fatalf("Expected the details to be redacted, got '%+v'", hc)
+	}
+
+	hc, code = get("1")
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusServiceUnavailable, code)
+	}
+	if _, ok := hc.Tests["db_primary"]; !ok {
+		t.Fatalf("Expected the full response, got '%+v'", hc)
+	}
+}
+
+func TestRedactMiddleware_Enumeration(t *testing.T) {
+	defer resetTests()
+	defer func() {
+		EnableMetrics = false
+	}()
+
+	EnableMetrics = true
+	RegisterTest("payments", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("connection refused")
+	}, WithComponent("billing"))
+
+	srv := httptest.NewServer(NewHandlerWithMiddleware(nil, RedactMiddleware(func(*http.Request) bool {
+		return false
+	})))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path     string
+		expected int
+	}{
+		// the filters are ignored, so every request reports the overall status
+		{"/_hcheck?test=payments*", http.StatusServiceUnavailable},
+		{"/_hcheck?test=nope", http.StatusServiceUnavailable},
+		{"/_hcheck?tag=nope", http.StatusServiceUnavailable},
+		{"/_hcheck/components/billing", http.StatusNotFound},
+		{"/_hcheck/components/nope", http.StatusNotFound},
+		{"/_hcheck/metrics", http.StatusForbidden},
+	} {
+		rsp, err := http.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		body, err := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+
+		if rsp.StatusCode != tc.expected {
+			t.Fatalf("Expected status code of '%s' to equal '%d', got '%d'", tc.path, tc.expected, rsp.StatusCode)
+		}
+		if strings.Contains(string(body), "payments") {
+			t.Fatalf("Expected '%s' not to disclose the test, got '%s'", tc.path, body)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// DepthHeader represents the request header carrying how many health
+	// checks deep a request is. A RemoteCheck sends the depth of the request
+	// it runs for plus one, and a request without the header has a depth of
+	// zero. Invalid values are responded to with 400 Bad Request.
+	DepthHeader = "X-Health-Depth"
+
+	// ViaHeader represents the request header carrying the comma separated
+	// ServiceNames of the health checks a request passed through. A
+	// RemoteCheck appends the ServiceName to the ones of the request it runs
+	// for.
+	ViaHeader = "X-Health-Via"
+
+	// MaxDepth represents the depth beyond which a RemoteCheck doesn't call its
+	// dependency, so chained health checks can't fan out indefinitely.
+	MaxDepth = 3
+
+	// ServiceName represents the name under which this service appears in the
+	// ViaHeader. A request which already passed through it is part of a cycle,
+	// for which a RemoteCheck doesn't call its dependency. It defaults to the
+	// hostname.
+	ServiceName, _ = os.Hostname()
+)
+
+type chainKey struct{}
+
+// chain represents the health checks a request passed through.
+type chain struct {
+	depth int
+	via   []string
+}
+
+// withChain stores the chain of the request, as given by its DepthHeader and
+// ViaHeader, in the context.
+func withChain(ctx context.Context, r *http.Request) (context.Context, error) {
+	var c chain
+	if h := r.Header.Get(DepthHeader); h != "" {
+		depth, err := strconv.Atoi(h)
+		if err != nil || depth < 0 {
+			return ctx, fmt.Errorf("invalid %s header %q", DepthHeader, h)
+		}
+		c.depth = depth
+	}
+	for _, name := range strings.Split(r.Header.Get(ViaHeader), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			c.via = append(c.via, name)
+		}
+	}
+
+	return context.WithValue(ctx, chainKey{}, c), nil
+}
+
+// RemoteCheck returns a TestFunc which requests the health endpoint of a
+// dependency at the given URL, and reports Available, Degraded or Unavailable
+// according to its status. A dependency which can't be reached, or doesn't
+// respond with a health check, is Unavailable. When client is nil,
+// http.DefaultClient is used.
+//
+// The request carries the DepthHeader and ViaHeader, so a chain of services
+// checking each other is bounded: once the request would exceed the MaxDepth,
+// or this service is already part of the chain, the dependency isn't called
+// and the test is Skipped, leaving it to the services further up the chain.
+func RemoteCheck(url string, client *http.Client) TestFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return func(ctx context.Context) (Status, error) {
+		SetDetail(ctx, "url", url)
+
+		c, _ := ctx.Value(chainKey{}).(chain)
+		for _, name := range c.via {
+			if name == ServiceName {
+				return Skipped, fmt.Errorf("%s is already part of the chain %s", ServiceName, strings.Join(c.via, ", "))
+			}
+		}
+		if c.depth+1 > MaxDepth {
+			return Skipped, fmt.Errorf("depth of %d exceeds %d", c.depth+1, MaxDepth)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return Unavailable, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set(DepthHeader, strconv.Itoa(c.depth+1))
+		req.Header.Set(ViaHeader, strings.Join(append(c.via[:len(c.via):len(c.via)], ServiceName), ","))
+
+		rsp, err := client.Do(req)
+		if err != nil {
+			return Unavailable, err
+		}
+		defer rsp.Body.Close()
+
+		var hc HealthCheck
+		if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil || hc.Status == "" {
+			return Unavailable, fmt.Errorf("unexpected response with status code %d", rsp.StatusCode)
+		}
+		SetDetail(ctx, "status", hc.Status)
+
+		switch statusLevel(hc.Status) {
+		case 0:
+			return Available, nil
+		case 1:
+			return Degraded, fmt.Errorf("dependency is %s", hc.Status)
+		default:
+			return Unavailable, fmt.Errorf("dependency is %s", hc.Status)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package hcheck
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteCheck(t *testing.T) {
+	defer resetTests()
+
+	var depth, via string
+	calls := 0
+	dep := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		depth, via = r.Header.Get(DepthHeader), r.Header.Get(ViaHeader)
+		json.NewEncoder(w).Encode(HealthCheck{Status: Degraded})
+	}))
+	defer dep.Close()
+
+	RegisterTest("dependency", RemoteCheck(dep.URL, nil))
+
+	srv := httptest.NewServer(NewHandler(nil))
+	defer srv.Close()
+
+	get := func(headers map[string]string) (HealthCheck, int) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/_hcheck", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		var hc HealthCheck
+		json.NewDecoder(rsp.Body).Decode(&hc)
+		return hc, rsp.StatusCode
+	}
+
+	hc, _ := get(nil)
+	if s := hc.Tests["dependency"].Status; s != Degraded {
+		t.Fatalf("Expected 'dependency' to equal '%s', got '%s'", Degraded, s)
+	}
+	if depth != "1" || via != ServiceName {
+		t.Fatalf("Expected the chain '1' '%s', got '%s' '%s'", ServiceName, depth, via)
+	}
+
+	hc, _ = get(map[string]string{DepthHeader: "2", ViaHeader: "edge"})
+	if depth != "3" || via != "edge,"+ServiceName {
+		t.Fatalf("Expected the chain '3' 'edge,%s', got '%s' '%s'", ServiceName, depth, via)
+	}
+
+	for _, headers := range []map[string]string{
+		{DepthHeader: "3"},
+		{ViaHeader: "edge, " + ServiceName},
+	} {
+		calls = 0
+		hc, _ = get(headers)
+		if s := hc.Tests["dependency"].Status; s != Skipped {
+			t.Fatalf("Expected 'dependency' to equal '%s', got '%s'", Skipped, s)
+		}
+		if hc.Status != Available {
+			t.Fatalf("Expected result to equal '%s', got '%s'", Available, hc.Status)
+		}
+		if calls != 0 {
+			t.Fatalf("Expected the dependency not to be called, got '%d' calls", calls)
+		}
+	}
+
+	if _, code := get(map[string]string{DepthHeader: "deep"}); code != http.StatusBadRequest {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusBadRequest, code)
+	}
+
+	dep.Close()
+	hc, _ = get(nil)
+	if s := hc.Tests["dependency"].Status; s != Unavailable {
+		t.Fatalf("Expected 'dependency' to equal '%s', got '%s'", Unavailable, s)
+	}
+}
@@ -0,0 +1,73 @@
+// Package router mounts the health check on third party routers, such as chi
+// and gorilla/mux, without depending on them.
+//
+// With chi, the endpoints are mounted through Mount:
+//
+//	r := chi.NewRouter()
+//	router.Mount(r, middleware.Logger)
+//
+// With gorilla/mux, whose Handle method returns a route, the handler is
+// mounted on the path prefix directly:
+//
+//	r := mux.NewRouter()
+//	r.PathPrefix(router.Path()).Handler(router.Handler(router.FromGorilla(mw)...))
+package router
+
+import (
+	"net/http"
+
+	hcheck "github.com/sambacha/service-healthcheck"
+)
+
+// Router represents a router which registers handlers by pattern, such as
+// chi.Router. Patterns ending in "/*" match all paths below them.
+type Router interface {
+	Handle(pattern string, h http.Handler)
+}
+
+// GorillaMiddleware represents the middleware interface of gorilla/mux, which
+// is implemented by mux.MiddlewareFunc.
+type GorillaMiddleware interface {
+	Middleware(http.Handler) http.Handler
+}
+
+// Path returns the path of the health endpoint. The component scoped endpoints
+// are served below it.
+func Path() string {
+	return hcheck.Prefix + hcheck.Endpoint
+}
+
+// Handler returns the health endpoints wrapped in the provided middleware.
+func Handler(mw ...hcheck.MiddlewareFunc) http.Handler {
+	return hcheck.Handler(mw...)
+}
+
+// Mount registers the health endpoints on the given router, wrapped in the
+// provided middleware. The middleware can be passed as is, such as the ones
+// found in chi's middleware package.
+func Mount(r Router, mw ...func(http.Handler) http.Handler) {
+	h := Handler(FromFuncs(mw...)...)
+
+	r.Handle(Path(), h)
+	r.Handle(Path()+"/*", h)
+}
+
+// FromFuncs converts plain middleware functions into hcheck middleware.
+func FromFuncs(mw ...func(http.Handler) http.Handler) []hcheck.MiddlewareFunc {
+	mws := make([]hcheck.MiddlewareFunc, len(mw))
+	for i, m := range mw {
+		mws[i] = hcheck.MiddlewareFunc(m)
+	}
+
+	return mws
+}
+
+// FromGorilla converts gorilla/mux middleware into hcheck middleware.
+func FromGorilla(mw ...GorillaMiddleware) []hcheck.MiddlewareFunc {
+	mws := make([]hcheck.MiddlewareFunc, len(mw))
+	for i, m := range mw {
+		mws[i] = m.Middleware
+	}
+
+	return mws
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeRouter map[string]http.Handler
+
+func (f fakeRouter) Handle(pattern string, h http.Handler) {
+	f[pattern] = h
+}
+
+type gorillaMiddleware func(http.Handler) http.Handler
+
+func (mw gorillaMiddleware) Middleware(h http.Handler) http.Handler {
+	return mw(h)
+}
+
+func TestMount(t *testing.T) {
+	calls := 0
+	mw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	r := fakeRouter{}
+	Mount(r, mw)
+
+	for _, pattern := range []string{"/_hcheck", "/_hcheck/*"} {
+		if _, ok := r[pattern]; !ok {
+			t.Fatalf("Expected pattern '%s' to be registered", pattern)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	r["/_hcheck"].ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_hcheck", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, rec.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected middleware to be called once, got '%d'", calls)
+	}
+}
+
+func TestFromGorilla(t *testing.T) {
+	calls := 0
+	mw := gorillaMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	rec := httptest.NewRecorder()
+	Handler(FromGorilla(mw)...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path()+"/unknown", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusNotFound, rec.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected middleware to be called once, got '%d'", calls)
+	}
+}
@@ -0,0 +1,91 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// runPath represents the path, relative to the health check endpoint, on
+// which a single test can be run.
+const runPath = "/run/"
+
+// AuthorizeRun serves an endpoint on /_hcheck/run/{name} which runs a single
+// test on a POST request, through RunTest, and responds with its full result,
+// to confirm a fix without waiting for the next probe. As it runs tests on
+// demand, it responds with 403 Forbidden to the callers for which the
+// predicate returns false, and with 404 Not Found for an unknown test. When
+// nil, the endpoint isn't served. It has to be set before registering the
+// handler.
+var AuthorizeRun func(r *http.Request) bool
+
+// RunTest runs the registered test with the given name right away, within the
+// Timeout, and returns its result. Unlike a request to the health endpoint, it
+// bypasses the cache of the responses. It returns ErrUnknownTest when there's
+// no such test, and an error when the context is canceled before the test
+// completed.
+func RunTest(ctx context.Context, name string) (Test, error) {
+	reg, ok := registeredTests()[name]
+	if !ok {
+		return Test{}, ErrUnknownTest
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	rspChan := make(chan Test, 1)
+	go runTest(ctx, name, reg, rspChan)
+
+	select {
+	case t := <-rspChan:
+		return t, nil
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return Test{}, ctx.Err()
+		}
+		return timedOutTest(name, reg, Timeout), nil
+	}
+}
+
+// CheckNow runs all registered tests right away, within the Timeout or the
+// deadline of the context when that's sooner, and returns the result. It
+// bypasses the cache of the responses, and the result is tracked like the one
+// of a request, so it's available through Snapshot and triggers
+// OnStatusChange. It returns an error when the context is canceled before all
+// tests completed.
+func CheckNow(ctx context.Context) (HealthCheck, error) {
+	hc, err := check(ctx, registeredTests(), Timeout)
+	if err != nil {
+		return hc, err
+	}
+
+	trackStatus(hc)
+	return hc, nil
+}
+
+func runHandler(w http.ResponseWriter, r *http.Request) {
+	if !AuthorizeRun(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	t, err := RunTest(r.Context(), strings.TrimPrefix(r.URL.Path, Prefix+Endpoint+runPath))
+	switch {
+	case err == ErrUnknownTest:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		// the client went away, there's nobody left to respond to
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(t)
+}
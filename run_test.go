@@ -0,0 +1,105 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunTest(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("db", func(ctx context.Context) (Status, error) {
+		SetDetail(ctx, "replica", "eu-1")
+		return Degraded, errors.New("replica lagging")
+	})
+
+	tst, err := RunTest(context.Background(), "db")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if tst.Status != Degraded || tst.Details["replica"] != "eu-1" {
+		t.Fatalf("Expected the full result of the test, got '%+v'", tst)
+	}
+
+	if _, err := RunTest(context.Background(), "missing"); err != ErrUnknownTest {
+		t.Fatalf("Expected error to equal '%v', got '%v'", ErrUnknownTest, err)
+	}
+}
+
+func TestRunHandler(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+	defer func() {
+		AuthorizeRun = nil
+		CacheTTL = 0
+	}()
+
+	var runs int32
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		atomic.AddInt32(&runs, 1)
+		return Available, nil
+	})
+
+	AuthorizeRun = func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret"
+	}
+	CacheTTL = time.Minute
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	post := func(name, auth string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/_hcheck/run/"+name, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		req.Header.Set("Authorization", auth)
+
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return rsp
+	}
+
+	if _, _, err := getHealth(); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	rsp := post("db", "Bearer secret")
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusOK, rsp.StatusCode)
+	}
+	var tst Test
+	if err := json.NewDecoder(rsp.Body).Decode(&tst); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if tst.Name != "db" || tst.Status != Available {
+		t.Fatalf("Expected the result of test '%s', got '%+v'", "db", tst)
+	}
+	if n := atomic.LoadInt32(&runs); n != 2 {
+		t.Fatalf("Expected the cache to be bypassed, got '%d' runs", n)
+	}
+
+	for _, tc := range []struct {
+		name, auth string
+		expected   int
+	}{
+		{"db", "", http.StatusForbidden},
+		{"missing", "Bearer secret", http.StatusNotFound},
+	} {
+		rsp := post(tc.name, tc.auth)
+		rsp.Body.Close()
+		if rsp.StatusCode != tc.expected {
+			t.Fatalf("Expected status code to equal '%d', got '%d'", tc.expected, rsp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package hcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateSchema = flag.Bool("update", false, "update schema.json from the HealthCheck struct")
+
+func TestSchema_UpToDate(t *testing.T) {
+	generated := generateSchema()
+	if *updateSchema {
+		if err := os.WriteFile("schema.json", generated, 0644); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	}
+
+	current, err := os.ReadFile("schema.json")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if !bytes.Equal(current, generated) {
+		t.Fatalf("Expected schema.json to be up to date, run `go test -run TestSchema -update`")
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	defer resetTests()
+
+	IncludeRuntime = true
+	RegisterTest("degraded", func(ctx context.Context) (Status, error) {
+		SetDetail(ctx, "replicas", 2)
+		return Degraded, errors.New("degraded")
+	}, WithComponent("db"), WithTags("external"))
+
+	srv := httptest.NewServer(NewHandler(nil))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/_hcheck")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	var schema, doc interface{}
+	b, err := os.ReadFile("schema.json")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	if err := validateSchema(schema.(map[string]interface{}), doc, "$"); err != nil {
+		t.Fatalf("Expected response to validate against schema.json, got '%s'", err.Error())
+	}
+}
+
+func generateSchema() []byte {
+	schema := typeSchema(reflect.TypeOf(HealthCheck{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "HealthCheck"
+	schema["description"] = "Response of the health check endpoint, schema version " + SchemaVersion
+
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return append(b, '\n')
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(Duration(0)):
+		return map[string]interface{}{"type": "number"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if f.PkgPath != "" || tag == "-" {
+				continue
+			}
+
+			name, opts := tag, ""
+			if i := strings.Index(tag, ","); i >= 0 {
+				name, opts = tag[:i], tag[i:]
+			}
+			properties[name] = typeSchema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+
+		// unknown properties are allowed, as new optional fields don't bump
+		// the SchemaVersion
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	default:
+		panic(fmt.Sprintf("unsupported type %s", t))
+	}
+}
+
+// validateSchema validates the document against the subset of JSON Schema
+// which is generated by typeSchema.
+func validateSchema(schema map[string]interface{}, doc interface{}, path string) error {
+	switch schema["type"] {
+	case nil:
+		return nil
+	case "string":
+		if _, ok := doc.(string); !ok {
+			return fmt.Errorf("%s: expected a string, got %T", path, doc)
+		}
+	case "boolean":
+		if _, ok := doc.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %T", path, doc)
+		}
+	case "integer", "number":
+		n, ok := doc.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected a number, got %T", path, doc)
+		}
+		if schema["type"] == "integer" && n != float64(int64(n)) {
+			return fmt.Errorf("%s: expected an integer, got %v", path, n)
+		}
+	case "array":
+		items, ok := doc.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %T", path, doc)
+		}
+		for i, item := range items {
+			if err := validateSchema(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %T", path, doc)
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := obj[name.(string)]; !ok {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+
+		for name, value := range obj {
+			s, ok := properties[name].(map[string]interface{})
+			if !ok {
+				switch additional := schema["additionalProperties"].(type) {
+				case map[string]interface{}:
+					s = additional
+				case bool:
+					if !additional {
+						return fmt.Errorf("%s: unexpected property %q", path, name)
+					}
+					continue
+				default:
+					continue
+				}
+			}
+
+			if err := validateSchema(s, value, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package hcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EpochMillis can be used as TimeFormat to render timestamps as milliseconds
+// since the Unix epoch.
+const EpochMillis = "epoch_ms"
+
+// DurationFloat and DurationInteger can be used as DurationFormat to render
+// durations as fractional or as rounded milliseconds respectively.
+const (
+	DurationFloat   = "float"
+	DurationInteger = "integer"
+)
+
+var (
+	// TimeFormat represents the layout, as understood by time.Format, used by
+	// the JSONSerializer to render the checked_at timestamp. EpochMillis
+	// renders it as a number instead. When empty, the default time.Time JSON
+	// encoding is used.
+	TimeFormat = ""
+
+	// TimeLocation represents the location the checked_at timestamp is
+	// converted to before it's rendered. When nil, the timestamp is rendered in
+	// its own location.
+	TimeLocation *time.Location
+
+	// DurationFormat represents the format used by the JSONSerializer to render
+	// durations in milliseconds, either DurationFloat or DurationInteger for
+	// consumers which reject fractional numbers.
+	DurationFormat = DurationFloat
+
+	// DefaultSerializer represents the serializer used to write the response
+	// when the request doesn't ask for any of the Serializers. Set it to a
+	// JSONSerializer with a MediaType to respond with a vendor content type.
+	DefaultSerializer Serializer = JSONSerializer{}
+
+	// Serializers represents the serializers which can be selected through the
+	// Accept header of the request, keyed by media type. The first media type
+	// of the Accept header which has a serializer is used.
+	Serializers = map[string]Serializer{
+		"application/json":       JSONSerializer{},
+		"text/plain":             NagiosSerializer{},
+		"application/x-ndjson":   NDJSONSerializer{},
+		"application/x-protobuf": ProtobufSerializer{},
+	}
+)
+
+// Serializer represents a format in which the HealthCheck is written to the
+// response.
+type Serializer interface {
+	// ContentType returns the media type of the serialized HealthCheck.
+	ContentType() string
+
+	// Serialize writes the HealthCheck to the given writer.
+	Serialize(io.Writer, HealthCheck) error
+}
+
+// JSONSerializer serializes the HealthCheck as JSON.
+type JSONSerializer struct {
+	// MediaType represents the content type of the response, for gateways
+	// which require a vendor media type such as
+	// application/vnd.myco.health+json. When empty, application/json is used.
+	MediaType string
+}
+
+// ContentType returns the MediaType, or the JSON media type when it's empty.
+func (s JSONSerializer) ContentType() string {
+	if s.MediaType != "" {
+		return s.MediaType
+	}
+
+	return "application/json"
+}
+
+// Serialize writes the HealthCheck as JSON, rendering the checked_at timestamp
+// according to TimeFormat and TimeLocation.
+func (JSONSerializer) Serialize(w io.Writer, hc HealthCheck) error {
+	if TimeFormat == "" && TimeLocation == nil {
+		return json.NewEncoder(w).Encode(hc)
+	}
+
+	type healthCheck HealthCheck
+	return json.NewEncoder(w).Encode(struct {
+		healthCheck
+		CheckedAt interface{} `json:"checked_at"`
+	}{healthCheck(hc), formatTime(hc.CheckedAt)})
+}
+
+func formatTime(t time.Time) interface{} {
+	if TimeLocation != nil {
+		t = t.In(TimeLocation)
+	}
+
+	switch TimeFormat {
+	case "":
+		return t
+	case EpochMillis:
+		return t.UnixNano() / int64(time.Millisecond)
+	default:
+		return t.Format(TimeFormat)
+	}
+}
+
+// NagiosSerializer serializes the HealthCheck as monitoring plugin output, as
+// expected by Nagios and Icinga. It writes a single status line, followed by
+// the duration of every test as performance data, e.g.
+//
+//	WARNING - s3: degraded | db=12ms;;; s3=40ms;;;
+//
+// Available, Degraded and Unavailable map to OK, WARNING and CRITICAL.
+type NagiosSerializer struct{}
+
+// ContentType returns the plain text media type.
+func (NagiosSerializer) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+// Serialize writes the HealthCheck as monitoring plugin output.
+func (NagiosSerializer) Serialize(w io.Writer, hc HealthCheck) error {
+	names := make([]string, 0, len(hc.Tests))
+	for name := range hc.Tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failing := make([]string, 0, len(names))
+	for _, name := range names {
+		if statusLevel(hc.Tests[name].Status) > 0 {
+			failing = append(failing, name)
+		}
+	}
+	sort.SliceStable(failing, func(i, j int) bool {
+		return rank(hc.Tests[failing[i]].Status) > rank(hc.Tests[failing[j]].Status)
+	})
+
+	var line strings.Builder
+	switch statusLevel(hc.Status) {
+	case 0:
+		line.WriteString("OK - all checks passing")
+	case 1:
+		line.WriteString("WARNING - ")
+	default:
+		line.WriteString("CRITICAL - ")
+	}
+
+	for i, name := range failing {
+		if i > 0 {
+			line.WriteString(", ")
+		}
+		fmt.Fprintf(&line, "%s: %s", name, hc.Tests[name].Status)
+	}
+
+	for i, name := range names {
+		if i == 0 {
+			line.WriteString(" |")
+		}
+		fmt.Fprintf(&line, " %s=%dms;;;", perfdataLabel(name), time.Duration(hc.Tests[name].DurationMs).Milliseconds())
+	}
+	line.WriteString("\n")
+
+	_, err := io.WriteString(w, line.String())
+	return err
+}
+
+// NDJSONSerializer serializes the HealthCheck as newline-delimited JSON, for
+// log pipelines which parse their input line by line. It writes a line for
+// every test, ordered by name, followed by a line with the rest of the
+// HealthCheck, e.g.
+//
+//	{"name":"db","duration_ms":12,"status":"available"}
+//	{"schema_version":"2","checked_at":"...","status":"available",...}
+type NDJSONSerializer struct{}
+
+// ContentType returns the newline-delimited JSON media type.
+func (NDJSONSerializer) ContentType() string {
+	return "application/x-ndjson"
+}
+
+// Serialize writes the tests and the HealthCheck as newline-delimited JSON.
+func (NDJSONSerializer) Serialize(w io.Writer, hc HealthCheck) error {
+	names := make([]string, 0, len(hc.Tests))
+	for name := range hc.Tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	enc := json.NewEncoder(w)
+	for _, name := range names {
+		if err := enc.Encode(hc.Tests[name]); err != nil {
+			return err
+		}
+	}
+
+	type healthCheck HealthCheck
+	return enc.Encode(struct {
+		healthCheck
+		CheckedAt interface{} `json:"checked_at"`
+		Tests     *struct{}   `json:"tests,omitempty"`
+	}{healthCheck: healthCheck(hc), CheckedAt: formatTime(hc.CheckedAt)})
+}
+
+// perfdataLabel quotes the label when it contains characters which aren't
+// allowed in an unquoted performance data label.
+func perfdataLabel(label string) string {
+	if !strings.ContainsAny(label, " ='") {
+		return label
+	}
+
+	return "'" + strings.Replace(label, "'", "''", -1) + "'"
+}
+
+func negotiateSerializer(r *http.Request) Serializer {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		if s, ok := Serializers[mediaType]; ok {
+			return s
+		}
+	}
+
+	return DefaultSerializer
+}
+
+// Duration represents a duration which is rendered in milliseconds, as a
+// fractional or rounded number according to DurationFormat.
+type Duration time.Duration
+
+// MarshalJSON renders the duration in milliseconds according to
+// DurationFormat.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	if DurationFormat == DurationInteger {
+		return []byte(strconv.FormatInt(time.Duration(d).Round(time.Millisecond).Milliseconds(), 10)), nil
+	}
+
+	return []byte(strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)), nil
+}
+
+// UnmarshalJSON parses a duration in milliseconds, in either format.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	ms, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(ms * float64(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,301 @@
+package hcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNagiosSerializer(t *testing.T) {
+	tcs := []struct {
+		hc       HealthCheck
+		expected string
+	}{
+		{
+			hc: HealthCheck{Status: Available, Tests: map[string]Test{
+				"db": {Name: "db", Status: Available, DurationMs: Duration(12 * time.Millisecond)},
+			}},
+			expected: "OK - all checks passing | db=12ms;;;\n",
+		},
+		{
+			hc: HealthCheck{Status: Degraded, Tests: map[string]Test{
+				"db": {Name: "db", Status: Available, DurationMs: Duration(12 * time.Millisecond)},
+				"s3": {Name: "s3", Status: Degraded, DurationMs: Duration(40 * time.Millisecond)},
+			}},
+			expected: "WARNING - s3: degraded | db=12ms;;; s3=40ms;;;\n",
+		},
+		{
+			hc: HealthCheck{Status: Unavailable, Tests: map[string]Test{
+				"a cache": {Name: "a cache", Status: Degraded, DurationMs: Duration(1 * time.Millisecond)},
+				"db":      {Name: "db", Status: Unavailable, DurationMs: Duration(5 * time.Millisecond)},
+			}},
+			expected: "CRITICAL - db: unavailable, a cache: degraded | 'a cache'=1ms;;; db=5ms;;;\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		var buf bytes.Buffer
+		if err := (NagiosSerializer{}).Serialize(&buf, tc.hc); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if buf.String() != tc.expected {
+			t.Fatalf("Expected output to equal '%s', got '%s'", tc.expected, buf.String())
+		}
+	}
+}
+
+func TestJSONSerializer_TimeFormat(t *testing.T) {
+	defer func() {
+		TimeFormat = ""
+		TimeLocation = nil
+	}()
+
+	checkedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tcs := []struct {
+		format   string
+		location *time.Location
+		expected string
+	}{
+		{"", nil, `"2020-01-02T03:04:05Z"`},
+		{EpochMillis, nil, `1577934245000`},
+		{time.RFC1123, nil, `"Thu, 02 Jan 2020 03:04:05 UTC"`},
+		{time.RFC3339, time.FixedZone("CET", 3600), `"2020-01-02T04:04:05+01:00"`},
+	}
+
+	for _, tc := range tcs {
+		TimeFormat, TimeLocation = tc.format, tc.location
+
+		var buf bytes.Buffer
+		if err := (JSONSerializer{}).Serialize(&buf, HealthCheck{CheckedAt: checkedAt, Status: Available}); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+
+		out := map[string]json.RawMessage{}
+		if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if got := string(out["checked_at"]); got != tc.expected {
+			t.Fatalf("Expected checked_at to equal '%s', got '%s'", tc.expected, got)
+		}
+		if got := string(out["status"]); got != `"available"` {
+			t.Fatalf("Expected status to equal '%s', got '%s'", `"available"`, got)
+		}
+	}
+}
+
+func TestJSONSerializer_DurationFormat(t *testing.T) {
+	defer func() {
+		DurationFormat = DurationFloat
+	}()
+
+	tcs := []struct {
+		format   string
+		expected string
+	}{
+		{DurationFloat, `12.345`},
+		{DurationInteger, `12`},
+	}
+
+	for _, tc := range tcs {
+		DurationFormat = tc.format
+
+		var buf bytes.Buffer
+		hc := HealthCheck{Status: Available, DurationMs: Duration(12345 * time.Microsecond)}
+		if err := (JSONSerializer{}).Serialize(&buf, hc); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+
+		out := map[string]json.RawMessage{}
+		if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if got := string(out["duration_ms"]); got != tc.expected {
+			t.Fatalf("Expected duration_ms to equal '%s', got '%s'", tc.expected, got)
+		}
+
+		var decoded HealthCheck
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+	}
+}
+
+func TestNDJSONSerializer(t *testing.T) {
+	hc := HealthCheck{Status: Degraded, Tests: map[string]Test{
+		"s3": {Name: "s3", Status: Degraded},
+		"db": {Name: "db", Status: Available},
+	}}
+
+	var buf bytes.Buffer
+	if err := (NDJSONSerializer{}).Serialize(&buf, hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("Expected '%d' lines, got '%d'", 3, len(lines))
+	}
+
+	for i, name := range []string{"db", "s3"} {
+		var test Test
+		if err := json.Unmarshal(lines[i], &test); err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if test.Name != name {
+			t.Fatalf("Expected line '%d' to be test '%s', got '%s'", i, name, test.Name)
+		}
+	}
+
+	out := map[string]json.RawMessage{}
+	if err := json.Unmarshal(lines[2], &out); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if got := string(out["status"]); got != `"degraded"` {
+		t.Fatalf("Expected status to equal '%s', got '%s'", `"degraded"`, got)
+	}
+	if _, ok := out["tests"]; ok {
+		t.Fatalf("Expected no tests in the last line, got '%s'", out["tests"])
+	}
+}
+
+func TestJSONSerializer_MediaType(t *testing.T) {
+	defer resetTests()
+	defer func() {
+		DefaultSerializer = JSONSerializer{}
+	}()
+
+	if ct := (JSONSerializer{}).ContentType(); ct != "application/json" {
+		t.Fatalf("Expected content type to equal '%s', got '%s'", "application/json", ct)
+	}
+
+	mediaType := "application/vnd.myco.health+json"
+	DefaultSerializer = JSONSerializer{MediaType: mediaType}
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/_hcheck")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if ct := rsp.Header.Get("Content-Type"); ct != mediaType {
+		t.Fatalf("Expected content type to equal '%s', got '%s'", mediaType, ct)
+	}
+
+	var hc HealthCheck
+	if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if hc.Status != Available {
+		t.Fatalf("Expected status to equal '%s', got '%s'", Available, hc.Status)
+	}
+}
+
+type failingSerializer struct{}
+
+func (failingSerializer) ContentType() string {
+	return "application/json"
+}
+
+func (failingSerializer) Serialize(w io.Writer, hc HealthCheck) error {
+	io.WriteString(w, `{"status":`)
+	return errors.New("cannot encode")
+}
+
+func TestSerializer_Error(t *testing.T) {
+	defer resetTests()
+	defer func() {
+		DefaultSerializer = JSONSerializer{}
+	}()
+
+	RegisterTest("s3", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("degraded")
+	})
+	DefaultSerializer = failingSerializer{}
+	EnableWeight = true
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	get := func() (*http.Response, string) {
+		rsp, err := http.Get(srv.URL + "/_hcheck")
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		body, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		return rsp, string(body)
+	}
+
+	rsp, body := get()
+	if rsp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusInternalServerError, rsp.StatusCode)
+	}
+	if body != "Internal Server Error\n" {
+		t.Fatalf("Expected no partial body, got '%s'", body)
+	}
+	if w := rsp.Header.Get("Warning"); w != "" {
+		t.Fatalf("Expected no warning, got '%s'", w)
+	}
+	if w := rsp.Header.Get(WeightHeader); w != "" {
+		t.Fatalf("Expected no weight, got '%s'", w)
+	}
+
+	EncodeErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, err.Error())
+	}
+
+	rsp, body = get()
+	if rsp.StatusCode != http.StatusServiceUnavailable || body != "cannot encode" {
+		t.Fatalf("Expected the custom response, got '%d' '%s'", rsp.StatusCode, body)
+	}
+}
+
+func TestSerializers_Accept(t *testing.T) {
+	defer resetTests()
+
+	RegisterTest("s3", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("degraded")
+	})
+
+	srv := httptest.NewServer(NewHandler(http.NewServeMux()))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/_hcheck", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	req.Header.Set("Accept", "text/plain;q=0.9, */*;q=0.1")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	expected := "WARNING - s3: degraded | default=0ms;;; s3=0ms;;;\n"
+	if string(body) != expected {
+		t.Fatalf("Expected body to equal '%s', got '%s'", expected, body)
+	}
+	if ct := rsp.Header.Get("Content-Type"); ct != (NagiosSerializer{}).ContentType() {
+		t.Fatalf("Expected content type to equal '%s', got '%s'", (NagiosSerializer{}).ContentType(), ct)
+	}
+}
@@ -0,0 +1,28 @@
+package hcheck
+
+import (
+	"net/http"
+	"time"
+)
+
+// NewServer returns a server for the given address, such as ":8081", which
+// only serves the health check, wrapped in the provided middleware, so it can
+// be exposed on an admin port which isn't reachable by public traffic. The
+// caller controls its lifecycle, e.g.
+//
+//	srv := hcheck.NewServer(":8081")
+//	go srv.ListenAndServe()
+//	defer srv.Shutdown(context.Background())
+//
+// Shutting the server down marks the service as draining through Drain, so a
+// DrainCheck served by another handler reports Unavailable from then on.
+func NewServer(addr string, mw ...MiddlewareFunc) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           Handler(mw...),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	srv.RegisterOnShutdown(Drain)
+
+	return srv
+}
@@ -0,0 +1,59 @@
+package hcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewServer(t *testing.T) {
+	defer resetTests()
+	defer atomic.StoreInt32(&draining, 0)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	srv := NewServer(ln.Addr().String())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ln)
+	}()
+
+	for _, tc := range []struct {
+		path     string
+		expected int
+	}{
+		{"/_hcheck", http.StatusOK},
+		{"/", http.StatusNotFound},
+	} {
+		rsp, err := http.Get("http://" + ln.Addr().String() + tc.path)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != tc.expected {
+			t.Fatalf("Expected status code of '%s' to equal '%d', got '%d'", tc.path, tc.expected, rsp.StatusCode)
+		}
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+	if err := <-done; err != http.ErrServerClosed {
+		t.Fatalf("Expected error to equal '%v', got '%v'", http.ErrServerClosed, err)
+	}
+	// the shutdown hooks run in their own goroutine
+	deadline := time.Now().Add(time.Second)
+	for !Draining() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !Draining() {
+		t.Fatalf("Expected the service to be draining after the shutdown")
+	}
+}
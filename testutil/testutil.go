@@ -0,0 +1,35 @@
+// Package testutil provides helpers to test code built on the health check,
+// such as aggregators, flapping detection and caching, deterministically.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	hcheck "github.com/sambacha/service-healthcheck"
+)
+
+// FlakyCheck returns a TestFunc which returns the statuses of the pattern in
+// sequence on successive calls, starting over at the end of the pattern, to
+// simulate a flaky dependency. A status other than Available comes with an
+// error. An empty pattern is always Available. It's safe to call from multiple
+// goroutines.
+func FlakyCheck(pattern []hcheck.Status) hcheck.TestFunc {
+	pattern = append([]hcheck.Status(nil), pattern...)
+
+	var calls uint64
+	return func(_ context.Context) (hcheck.Status, error) {
+		if len(pattern) == 0 {
+			return hcheck.Available, nil
+		}
+
+		n := atomic.AddUint64(&calls, 1) - 1
+		status := pattern[n%uint64(len(pattern))]
+		if status == hcheck.Available {
+			return status, nil
+		}
+
+		return status, fmt.Errorf("call %d is %s", n+1, status)
+	}
+}
@@ -0,0 +1,52 @@
+package testutil
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	hcheck "github.com/sambacha/service-healthcheck"
+)
+
+func TestFlakyCheck(t *testing.T) {
+	check := FlakyCheck([]hcheck.Status{hcheck.Available, hcheck.Unavailable, hcheck.Degraded})
+
+	expected := []hcheck.Status{hcheck.Available, hcheck.Unavailable, hcheck.Degraded, hcheck.Available}
+	for i, e := range expected {
+		s, err := check(context.Background())
+		if s != e {
+			t.Fatalf("Expected call '%d' to equal '%s', got '%s'", i+1, e, s)
+		}
+		if (s == hcheck.Available) != (err == nil) {
+			t.Fatalf("Expected an error only when not available, got '%v'", err)
+		}
+	}
+
+	if s, _ := FlakyCheck(nil)(context.Background()); s != hcheck.Available {
+		t.Fatalf("Expected status to equal '%s', got '%s'", hcheck.Available, s)
+	}
+}
+
+func TestFlakyCheck_Concurrent(t *testing.T) {
+	check := FlakyCheck([]hcheck.Status{hcheck.Available, hcheck.Unavailable})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	counts := map[hcheck.Status]int{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, _ := check(context.Background())
+
+			mu.Lock()
+			counts[s]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if counts[hcheck.Available] != 50 || counts[hcheck.Unavailable] != 50 {
+		t.Fatalf("Expected every status of the pattern '%d' times, got '%v'", 50, counts)
+	}
+}
@@ -0,0 +1,60 @@
+package hcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	// ValidateTimeout represents the duration Validate waits for the tests.
+	ValidateTimeout = 5 * time.Second
+
+	// ValidateFailOn represents the status from which a test fails Validate:
+	// Unavailable only fails on the tests which are critical, and Degraded on
+	// any failing test. Informational tests never fail it.
+	ValidateFailOn = Unavailable
+)
+
+// Validate runs all registered tests once through CheckNow, within the
+// ValidateTimeout, and returns an error listing the tests with the
+// ValidateFailOn, or a worse, status. It's meant to be called in main()
+// before serving, so a service which can't reach its dependencies fails fast
+// on boot rather than starting and reporting unhealthy right away:
+//
+//	if err := hcheck.Validate(); err != nil {
+//		log.Fatal(err)
+//	}
+func Validate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ValidateTimeout)
+	defer cancel()
+
+	hc, err := CheckNow(ctx)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(hc.Tests))
+	for name := range hc.Tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		t := hc.Tests[name]
+		if t.Informational || rank(t.Status) < rank(ValidateFailOn) {
+			continue
+		}
+
+		if t.Error != "" {
+			errs = append(errs, fmt.Errorf("%s is %s: %s", name, t.Status, t.Error))
+		} else {
+			errs = append(errs, fmt.Errorf("%s is %s", name, t.Status))
+		}
+	}
+
+	return errors.Join(errs...)
+}
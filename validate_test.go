@@ -0,0 +1,53 @@
+package hcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+	defer func() {
+		ValidateFailOn = Unavailable
+	}()
+
+	if err := Validate(); err != nil {
+		t.Fatalf("Expected no error, got '%s'", err.Error())
+	}
+
+	RegisterTest("cache", func(_ context.Context) (Status, error) {
+		return Degraded, errors.New("cache cold")
+	})
+	if err := Validate(); err != nil {
+		t.Fatalf("Expected no error for a degraded test, got '%s'", err.Error())
+	}
+
+	ValidateFailOn = Degraded
+	err := Validate()
+	if err == nil || err.Error() != "cache is degraded: cache cold" {
+		t.Fatalf("Expected error to equal '%s', got '%v'", "cache is degraded: cache cold", err)
+	}
+
+	RegisterTest("db", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("connection refused")
+	})
+	RegisterTest("metrics", func(_ context.Context) (Status, error) {
+		return Unavailable, errors.New("unreachable")
+	}, Informational())
+
+	err = Validate()
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	expected := "cache is degraded: cache cold\ndb is unavailable: connection refused"
+	if err.Error() != expected {
+		t.Fatalf("Expected error to equal '%s', got '%s'", expected, err.Error())
+	}
+
+	if s := Snapshot().Status; s != Unavailable {
+		t.Fatalf("Expected the result to be tracked, got '%s'", s)
+	}
+}
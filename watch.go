@@ -0,0 +1,54 @@
+package hcheck
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// watchPath represents the path, relative to the health check endpoint, on
+// which status changes can be watched.
+const watchPath = "/watch"
+
+var (
+	// EnableWatch serves a long-poll endpoint on /_hcheck/watch, which holds
+	// the request until the overall status changes and then responds with the
+	// result of the last run of all registered tests. The response carries an
+	// ETag, which the client passes back in the If-None-Match header of its
+	// next request to wait for the change after it. A request without it, or
+	// with an outdated one, is responded to right away. When the status doesn't
+	// change within WatchTimeout, the endpoint responds with 304 Not Modified
+	// and the client polls again. The endpoint never runs the tests itself, so
+	// it pairs with StartBackground. It has to be set before registering the
+	// handler.
+	EnableWatch = false
+
+	// WatchTimeout represents the maximum duration a watch request is held.
+	WatchTimeout = 30 * time.Second
+)
+
+func watchHandler(w http.ResponseWriter, r *http.Request) {
+	timer := time.NewTimer(WatchTimeout)
+	defer timer.Stop()
+
+	for {
+		hc, version, changed := watchState()
+		etag := strconv.Quote(strconv.FormatUint(version, 10))
+		if version > 0 && r.Header.Get("If-None-Match") != etag {
+			w.Header().Set("ETag", etag)
+			handleResponse(w, r, hc)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			// the client went away, there's nobody left to respond to
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package hcheck
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	defer resetTests()
+	resetNotify()
+	defer resetNotify()
+
+	EnableWatch = true
+	WatchTimeout = 50 * time.Millisecond
+	defer func() {
+		EnableWatch = false
+		WatchTimeout = 30 * time.Second
+	}()
+
+	trackStatus(HealthCheck{Status: Available, Tests: map[string]Test{}})
+
+	srv := httptest.NewServer(NewHandler(nil))
+	defer srv.Close()
+
+	watch := func(etag string) (*http.Response, HealthCheck) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/_hcheck/watch", nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got '%s'", err.Error())
+		}
+		defer rsp.Body.Close()
+
+		var hc HealthCheck
+		if rsp.StatusCode != http.StatusNotModified {
+			if err := json.NewDecoder(rsp.Body).Decode(&hc); err != nil {
+				t.Fatalf("Expected no error, got '%s'", err.Error())
+			}
+		}
+		return rsp, hc
+	}
+
+	// without an ETag the current result is returned right away
+	rsp, hc := watch("")
+	if hc.Status != Available {
+		t.Fatalf("Expected result to equal '%s', got '%s'", Available, hc.Status)
+	}
+	etag := rsp.Header.Get("ETag")
+
+	// without a change the request is held until the timeout
+	start := time.Now()
+	if rsp, _ = watch(etag); rsp.StatusCode != http.StatusNotModified {
+		t.Fatalf("Expected status code to equal '%d', got '%d'", http.StatusNotModified, rsp.StatusCode)
+	}
+	if d := time.Since(start); d < WatchTimeout {
+		t.Fatalf("Expected the request to be held for '%s', got '%s'", WatchTimeout, d)
+	}
+
+	WatchTimeout = 5 * time.Second
+	time.AfterFunc(20*time.Millisecond, func() {
+		trackStatus(HealthCheck{Status: Unavailable, Tests: map[string]Test{}})
+	})
+
+	rsp, hc = watch(etag)
+	if hc.Status != Unavailable {
+		t.Fatalf("Expected result to equal '%s', got '%s'", Unavailable, hc.Status)
+	}
+	if rsp.Header.Get("ETag") == etag {
+		t.Fatalf("Expected the ETag to change with the status")
+	}
+
+	// a client going away doesn't get a response
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/_hcheck/watch", nil).WithContext(ctx)
+	req.Header.Set("If-None-Match", rsp.Header.Get("ETag"))
+	rec := httptest.NewRecorder()
+	watchHandler(rec, req)
+	if rec.Body.Len() != 0 {
+		t.Fatalf("Expected no response, got '%s'", rec.Body.String())
+	}
+}